@@ -63,6 +63,11 @@ func startScan(srv []string, cbFun func(*Peripheral), dups bool) {
 }
 
 func StartScan(srv []string, cbFun func(*Peripheral), dups bool) {
+	if s := activeScanner; s != nil {
+		// The scanner callback is replaced, end it.
+		activeScanner = nil
+		s.finish()
+	}
 	scanSrv = srv
 	scanCbFun = cbFun
 	scanDups = dups
@@ -91,26 +96,33 @@ func stopScan() (err error) {
 	return
 }
 
+// StopScan stops scanning. The active Scanner, if any, is stopped too and its results channel closed.
 func StopScan() (err error) {
 	wantScan = false
+	if s := activeScanner; s != nil {
+		activeScanner = nil
+		s.finish()
+	}
 	return stopScan()
 }
 
-func Connect(id string, endConnCb func(per *Peripheral)) (per *Peripheral, err error) {
+// Connect connects to the peripheral with id and discovers its services.
+// endConnCb is called when the connection ends.
+func Connect(id string, endConnCb func(dev *Device)) (dev *Device, err error) {
 	if !IsEnabled() {
 		return nil, errors.New("Bluetooth disabled")
 	}
 	ch := make(chan struct{})
 	connected := false
 	success := func(obj *js.Object) {
-		per = newPeripheral(obj)
+		dev = newDevice(newPeripheral(obj))
 		connected = true
 		close(ch)
 	}
 	failure := func(obj *js.Object) {
 		if connected {
 			if endConnCb != nil {
-				endConnCb(per)
+				endConnCb(dev)
 			}
 		} else {
 			err = errors.New("Error connecting to BLE peripheral")
@@ -0,0 +1,229 @@
+package ble
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+var (
+	ErrNotSupported = errors.New("BLE operation not supported by characteristic")
+	ErrNoDevice     = errors.New("BLE characteristic not bound to a connected device")
+)
+
+// Property is a set of characteristic properties.
+type Property int
+
+const (
+	PropBroadcast Property = 1 << iota
+	PropRead
+	PropWriteWithoutResponse
+	PropWrite
+	PropNotify
+	PropIndicate
+	PropSignedWrite
+	PropExtended
+)
+
+// propertyNames maps the plugin property names (lower cased) to their Property.
+var propertyNames = map[string]Property{
+	"broadcast":                 PropBroadcast,
+	"read":                      PropRead,
+	"writewithoutresponse":      PropWriteWithoutResponse,
+	"write":                     PropWrite,
+	"notify":                    PropNotify,
+	"indicate":                  PropIndicate,
+	"authenticatedsignedwrites": PropSignedWrite,
+	"extendedproperties":        PropExtended,
+	// iOS reports these for characteristics requiring an encrypted link
+	"notifyencryptionrequired":   PropNotify,
+	"indicateencryptionrequired": PropIndicate,
+}
+
+// Device is a connected peripheral with its GATT services.
+// The embedded Peripheral keeps the advertising data; its advertised service UUIDs are
+// available through d.Peripheral.Services().
+type Device struct {
+	*Peripheral
+	services []*Service
+}
+
+// Service is a GATT service of a connected Device.
+type Service struct {
+	UUID            string
+	device          *Device
+	characteristics []*Characteristic
+}
+
+func newDevice(per *Peripheral) *Device {
+	d := &Device{Peripheral: per}
+	if srvs := per.Get("services"); srvs != nil && srvs != js.Undefined {
+		for _, item := range srvs.Interface().([]interface{}) {
+			d.service(item.(string))
+		}
+	}
+	for _, char := range per.characteristics {
+		char := char
+		char.device = d
+		srv := d.service(char.Service)
+		srv.characteristics = append(srv.characteristics, &char)
+	}
+	return d
+}
+
+// service returns the service with uuid, adding it when missing.
+func (d *Device) service(uuid string) *Service {
+	if srv := d.Service(uuid); srv != nil {
+		return srv
+	}
+	srv := &Service{UUID: uuid, device: d}
+	d.services = append(d.services, srv)
+	return srv
+}
+
+// Services returns the GATT services discovered on connection.
+func (d *Device) Services() []*Service {
+	return d.services
+}
+
+// Characteristics returns the characteristics of every service. Unlike Peripheral.Characteristics,
+// they are bound to the device, so their operations work.
+func (d *Device) Characteristics() []*Characteristic {
+	res := []*Characteristic{}
+	for _, srv := range d.services {
+		res = append(res, srv.characteristics...)
+	}
+	return res
+}
+
+// Service returns the service with the UUID, or nil if the device has none.
+func (d *Device) Service(uuid string) *Service {
+	for _, srv := range d.services {
+		if strings.EqualFold(srv.UUID, uuid) {
+			return srv
+		}
+	}
+	return nil
+}
+
+// Disconnect closes the connection with the device.
+func (d *Device) Disconnect() error {
+	return Disconnect(d.ID())
+}
+
+// IsConnected returns true while the device is connected.
+func (d *Device) IsConnected() bool {
+	return IsConnected(d.ID())
+}
+
+// ReadRSSI reads the current signal strength of the device.
+func (d *Device) ReadRSSI() (int, error) {
+	return ReadRSSI(d.ID())
+}
+
+// Device returns the device providing the service.
+func (s *Service) Device() *Device {
+	return s.device
+}
+
+// Characteristics returns the characteristics of the service.
+func (s *Service) Characteristics() []*Characteristic {
+	return s.characteristics
+}
+
+// Characteristic returns the characteristic with the UUID, or nil if the service has none.
+func (s *Service) Characteristic(uuid string) *Characteristic {
+	for _, char := range s.characteristics {
+		if strings.EqualFold(char.Characteristic, uuid) {
+			return char
+		}
+	}
+	return nil
+}
+
+// Props returns the parsed characteristic properties. Unknown names are ignored.
+func (c *Characteristic) Props() Property {
+	var props Property
+	for _, name := range c.Properties {
+		props |= propertyNames[strings.ToLower(name)]
+	}
+	return props
+}
+
+// Has returns true if the characteristic has every property in p.
+func (c *Characteristic) Has(p Property) bool {
+	return c.Props()&p == p
+}
+
+func (c *Characteristic) CanRead() bool {
+	return c.Has(PropRead)
+}
+
+func (c *Characteristic) CanWrite() bool {
+	return c.Has(PropWrite)
+}
+
+func (c *Characteristic) CanWriteWithoutResponse() bool {
+	return c.Has(PropWriteWithoutResponse)
+}
+
+func (c *Characteristic) CanNotify() bool {
+	return c.Has(PropNotify)
+}
+
+func (c *Characteristic) CanIndicate() bool {
+	return c.Has(PropIndicate)
+}
+
+// check returns an error when the characteristic is not bound to a device or lacks every property in props.
+func (c *Characteristic) check(op string, props Property) error {
+	if c.device == nil {
+		return ErrNoDevice
+	}
+	if c.Props()&props == 0 {
+		return fmt.Errorf("%w: %s %s", ErrNotSupported, op, c.Characteristic)
+	}
+	return nil
+}
+
+// Read reads the characteristic value.
+func (c *Characteristic) Read() ([]byte, error) {
+	if err := c.check("read", PropRead); err != nil {
+		return nil, err
+	}
+	return Read(c.device.ID(), c.Service, c.Characteristic)
+}
+
+// Write writes the characteristic value, waiting for the device response.
+func (c *Characteristic) Write(data []byte) error {
+	if err := c.check("write", PropWrite); err != nil {
+		return err
+	}
+	return Write(c.device.ID(), c.Service, c.Characteristic, data)
+}
+
+// WriteWithoutResponse writes the characteristic value without waiting for the device response.
+func (c *Characteristic) WriteWithoutResponse(data []byte) error {
+	if err := c.check("write without response", PropWriteWithoutResponse); err != nil {
+		return err
+	}
+	return WriteWithoutResponse(c.device.ID(), c.Service, c.Characteristic, data)
+}
+
+// Subscribe calls recvCb with every notified or indicated value.
+func (c *Characteristic) Subscribe(recvCb func([]byte)) error {
+	if err := c.check("subscribe", PropNotify|PropIndicate); err != nil {
+		return err
+	}
+	return StartNotification(c.device.ID(), c.Service, c.Characteristic, recvCb)
+}
+
+// Unsubscribe stops the notifications started by Subscribe.
+func (c *Characteristic) Unsubscribe() error {
+	if err := c.check("unsubscribe", PropNotify|PropIndicate); err != nil {
+		return err
+	}
+	return StopNotification(c.device.ID(), c.Service, c.Characteristic)
+}
@@ -14,6 +14,7 @@ type Characteristic struct {
 	Characteristic string
 	Properties     []string
 	Descriptors    []map[string]interface{}
+	device         *Device // Set on the characteristics of a Device
 }
 
 type Peripheral struct {
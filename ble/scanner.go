@@ -0,0 +1,134 @@
+package ble
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+var ErrScanBusy = errors.New("BLE scan already running")
+
+// activeScanner is the Scanner started by Scan, until it stops.
+var activeScanner *Scanner
+
+// ScanOptions filters and paces the results of a Scanner. Zero values disable each filter.
+type ScanOptions struct {
+	Services        []string      // Service UUIDs, filtered by the plugin
+	NamePrefix      string        // Advertised name prefix
+	ManufacturerIDs []uint16      // Accepted manufacturer (company) identifiers
+	MinRSSI         int           // Minimum signal strength in dBm, e.g. -80
+	RateLimit       time.Duration // Minimum interval between results of the same device. Zero reports each device once
+	Timeout         time.Duration // Scan duration, the scanner stops by itself after it
+	Buffer          int           // Capacity of the results channel, defaults to 32
+}
+
+// Scanner delivers the peripherals found by a scan through a channel.
+// Only one scan runs at a time; like StartScan, it is paused while connecting.
+type Scanner struct {
+	opts    ScanOptions
+	results chan *Peripheral
+
+	mu      sync.Mutex
+	stopped bool
+	seen    map[string]time.Time // Last result time by device ID
+}
+
+// Scan starts scanning with opts. Results that do not fit in the channel are dropped.
+func Scan(opts ScanOptions) (*Scanner, error) {
+	if wantScan {
+		return nil, ErrScanBusy
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 32
+	}
+	s := &Scanner{
+		opts:    opts,
+		results: make(chan *Peripheral, opts.Buffer),
+		seen:    map[string]time.Time{},
+	}
+	StartScan(opts.Services, s.found, opts.RateLimit > 0)
+	activeScanner = s
+	if opts.Timeout > 0 {
+		time.AfterFunc(opts.Timeout, func() {
+			s.Stop()
+		})
+	}
+	return s, nil
+}
+
+// Results returns the channel receiving the peripherals. It is closed when the scanner stops.
+func (s *Scanner) Results() <-chan *Peripheral {
+	return s.results
+}
+
+// Stop stops scanning and closes the results channel. StopScan stops the scanner as well.
+func (s *Scanner) Stop() error {
+	if activeScanner != s {
+		s.finish()
+		return nil
+	}
+	return StopScan()
+}
+
+// finish closes the results channel once.
+func (s *Scanner) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.results)
+	}
+}
+
+// found is the scan callback, it must not block.
+func (s *Scanner) found(p *Peripheral) {
+	if !s.match(p) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	now := time.Now()
+	if last, ok := s.seen[p.ID()]; ok && (s.opts.RateLimit <= 0 || now.Sub(last) < s.opts.RateLimit) {
+		return
+	}
+	s.seen[p.ID()] = now
+	select {
+	case s.results <- p:
+	default:
+	}
+}
+
+func (s *Scanner) match(p *Peripheral) bool {
+	if s.opts.MinRSSI != 0 && p.RSSI() < s.opts.MinRSSI {
+		return false
+	}
+	if s.opts.NamePrefix != "" {
+		name := p.name
+		if n := p.Get("name"); n != nil && n != js.Undefined {
+			name = n.String()
+		}
+		if !strings.HasPrefix(name, s.opts.NamePrefix) {
+			return false
+		}
+	}
+	if len(s.opts.ManufacturerIDs) > 0 {
+		ok := false
+		for _, id := range s.opts.ManufacturerIDs {
+			if _, found := p.ManufacturerData()[fmt.Sprintf("%04x", id)]; found {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// ErrChecksumMismatch is returned by ReadFileChecked when the file content does not match its checksum sidecar.
+var ErrChecksumMismatch = errors.New("Checksum mismatch error")
+
+// ChecksumSuffix is appended to the file name to build the name of its checksum sidecar.
+const ChecksumSuffix = ".sha256"
+
+// moveTo moves (or renames) the entry into the parent directory with the given name.
+func (e *Entry) moveTo(parent *DirectoryEntry, name string) (res *Entry, err error) {
+	ch := make(chan struct{})
+	success := func(en *Entry) {
+		res = en
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("moveTo", e.FullPath, obj)
+		safeClose(ch)
+	}
+	e.Call("moveTo", parent.Entry, name, success, fail)
+	<-ch
+	return
+}
+
+// WriteFileAtomic writes data to the file name inside dir so that readers either see the old content or the new one,
+// never a truncated file. Data is written to a temporary sibling file, its length is verified and
+// then it is moved over the original.
+func WriteFileAtomic(dir *DirectoryEntry, name string, data []byte) error {
+	parent, base := path.Split(name)
+	if parent != "" {
+		var err error
+		if dir, err = dir.GetDirectory(path.Clean(parent), nil); err != nil {
+			return err
+		}
+	}
+	tmp, err := dir.GetFile("."+base+".tmp", &Flags{Create: true})
+	if err != nil {
+		return err
+	}
+	if err := writeVerified(tmp, data); err != nil {
+		tmp.Remove()
+		return err
+	}
+	if _, err := tmp.moveTo(dir, base); err != nil {
+		tmp.Remove()
+		return err
+	}
+	return nil
+}
+
+func writeVerified(fe *FileEntry, data []byte) error {
+	if err := fe.Write(data); err != nil {
+		return err
+	}
+	md, err := fe.GetMetadata()
+	if err != nil {
+		return err
+	}
+	if md.Size() != int64(len(data)) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// WriteFileAtomicChecksum is like WriteFileAtomic but also writes (atomically) a sidecar file
+// named name+ChecksumSuffix holding the hex encoded SHA-256 of data. Use ReadFileChecked to read it back.
+// If the app dies between both writes, ReadFileChecked reports ErrChecksumMismatch.
+func WriteFileAtomicChecksum(dir *DirectoryEntry, name string, data []byte) error {
+	if err := WriteFileAtomic(dir, name, data); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	return WriteFileAtomic(dir, name+ChecksumSuffix, []byte(hex.EncodeToString(sum[:])))
+}
+
+// ReadFileChecked reads the file name inside dir and verifies it against the checksum sidecar written by
+// WriteFileAtomicChecksum. It returns ErrChecksumMismatch if the content is corrupted.
+func ReadFileChecked(dir *DirectoryEntry, name string) ([]byte, error) {
+	fe, err := dir.GetFile(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fe.Read()
+	if err != nil {
+		return nil, err
+	}
+	sfe, err := dir.GetFile(name+ChecksumSuffix, nil)
+	if err != nil {
+		return nil, err
+	}
+	want, err := sfe.Read()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(bytes.TrimSpace(want), []byte(hex.EncodeToString(sum[:]))) {
+		return nil, ErrChecksumMismatch
+	}
+	return data, nil
+}
@@ -5,8 +5,10 @@
 package file
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gopherjs/gopherjs/js"
@@ -43,7 +45,44 @@ const (
 	PathExistsErrVal            = 12
 )
 
-func (fe *FileError) Error() error {
+// FileError describes a failed file plugin operation.
+// It unwraps to one of the Err* sentinels, so errors.Is(err, ErrNotFound) works on errors returned by this package.
+type FileError struct {
+	Code int    // Plugin error code (one of *ErrVal constants)
+	Op   string // Plugin operation that failed
+	Path string // Full path (or URL) of the entry involved, if any
+}
+
+// newFileError builds a *FileError from the error object passed to a plugin failure callback.
+// FileReader and FileWriter report errors through a ProgressEvent whose target holds the FileError.
+func newFileError(op, path string, obj *js.Object) *FileError {
+	fe := &FileError{Op: op, Path: path}
+	if obj == nil || obj == js.Undefined {
+		return fe
+	}
+	if code := obj.Get("code"); code != js.Undefined && code != nil {
+		fe.Code = code.Int()
+	} else if target := obj.Get("target"); target != js.Undefined && target != nil {
+		if tErr := target.Get("error"); tErr != js.Undefined && tErr != nil {
+			fe.Code = tErr.Get("code").Int()
+		}
+	}
+	return fe
+}
+
+func (fe *FileError) Error() string {
+	msg := fmt.Sprintf("Unknown error: %d", fe.Code)
+	if err := fe.Unwrap(); err != nil {
+		msg = err.Error()
+	}
+	if fe.Path != "" {
+		return fe.Op + " " + fe.Path + ": " + msg
+	}
+	return fe.Op + ": " + msg
+}
+
+// Unwrap returns the sentinel error matching Code, or nil for unknown codes.
+func (fe *FileError) Unwrap() error {
 	switch fe.Code {
 	case NotFoundErrVal:
 		return ErrNotFound
@@ -70,7 +109,15 @@ func (fe *FileError) Error() error {
 	case PathExistsErrVal:
 		return ErrPathExists
 	}
-	return fmt.Errorf("Unknown error: %d", fe.Code)
+	return nil
+}
+
+// childPath returns the full path of name relative to the directory dir.
+func childPath(dir, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return strings.TrimSuffix(dir, "/") + "/" + name
 }
 
 type Directories struct {
@@ -140,23 +187,51 @@ func mo() *js.Object {
 	return instance
 }
 
+// safeClose closes ch unless it is already closed, so late or repeated plugin callbacks are harmless.
+func safeClose(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// FileSystemType is the storage type of a file system requested with RequestFileSystem.
+type FileSystemType int
+
+const (
+	// Temporary storage may be deleted by the browser at its discretion (window.TEMPORARY).
+	Temporary FileSystemType = 0
+	// Persistent storage can only be deleted by the app or the user (window.PERSISTENT).
+	Persistent FileSystemType = 1
+)
+
 // Metadata of file
 type Metadata struct {
 	*js.Object
 	ModificationTime time.Time `js:"modificationTime"`
-	Size             int       `js:"size"`
+}
+
+// ModTime returns the last modification time.
+func (md *Metadata) ModTime() time.Time {
+	ms := md.Get("modificationTime").Call("getTime").Int64()
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Size returns the size in bytes.
+func (md *Metadata) Size() int64 {
+	return md.Get("size").Int64()
 }
 
 // FileSystem type
 type FileSystem struct {
 	*js.Object
-	Name string          `js:"name"`
-	Root *DirectoryEntry `js:"root"`
+	Name string `js:"name"`
 }
 
-type FileError struct {
-	*js.Object
-	Code int `js:"code"`
+// Root returns the root directory of the file system.
+func (fsys *FileSystem) Root() *DirectoryEntry {
+	return &DirectoryEntry{Entry: &Entry{Object: fsys.Get("root")}}
 }
 
 type Flags struct {
@@ -217,200 +292,330 @@ func (e *Entry) AsFileEntry() *FileEntry {
 }
 
 // GetMetadata obtains metadata about the file, such as its modification date and size.
-func (e *Entry) GetMetadata() (res *Metadata, err error) {
+func (e *Entry) GetMetadata() (*Metadata, error) {
+	return e.GetMetadataContext(context.Background())
+}
+
+// GetMetadataContext is like GetMetadata but returns ctx.Err() if ctx is done before the plugin answers.
+func (e *Entry) GetMetadataContext(ctx context.Context) (res *Metadata, err error) {
 	ch := make(chan struct{})
 	success := func(md *Metadata) {
 		res = md
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("getMetadata", e.FullPath, obj)
+		safeClose(ch)
 	}
 	e.Call("getMetadata", success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
 // GetParent returns a entry representing the entry's parent directory.
-func (e *Entry) GetParent() (res *DirectoryEntry, err error) {
+func (e *Entry) GetParent() (*DirectoryEntry, error) {
+	return e.GetParentContext(context.Background())
+}
+
+// GetParentContext is like GetParent but returns ctx.Err() if ctx is done before the plugin answers.
+func (e *Entry) GetParentContext(ctx context.Context) (res *DirectoryEntry, err error) {
 	ch := make(chan struct{})
 	success := func(de *DirectoryEntry) {
 		res = de
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("getParent", e.FullPath, obj)
+		safeClose(ch)
 	}
 	e.Call("getParent", success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
-// CopyTo copies the file specified by the entry to a new target location on the file system.
-func (e *Entry) CopyTo(target *Entry) (res *Entry, err error) {
+// CopyTo copies the entry into the target directory, keeping its name.
+func (e *Entry) CopyTo(target *Entry) (*Entry, error) {
+	return e.CopyToContext(context.Background(), target)
+}
+
+// CopyToContext is like CopyTo but returns ctx.Err() if ctx is done before the plugin answers.
+func (e *Entry) CopyToContext(ctx context.Context, target *Entry) (res *Entry, err error) {
 	ch := make(chan struct{})
 	success := func(en *Entry) {
 		res = en
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("copyTo", e.FullPath, obj)
+		safeClose(ch)
+	}
+	e.Call("copyTo", target, nil, success, fail)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	e.Call("copyTo", target, success, fail)
-	<-ch
 	return
 }
 
-// MoveTo moves the file or directory to a new location on the file system, or renames the file or directory.
-func (e *Entry) MoveTo(target *Entry) (res *Entry, err error) {
+// MoveTo moves the file or directory into the target directory, keeping its name.
+func (e *Entry) MoveTo(target *Entry) (*Entry, error) {
+	return e.MoveToContext(context.Background(), target)
+}
+
+// MoveToContext is like MoveTo but returns ctx.Err() if ctx is done before the plugin answers.
+func (e *Entry) MoveToContext(ctx context.Context, target *Entry) (res *Entry, err error) {
 	ch := make(chan struct{})
 	success := func(en *Entry) {
 		res = en
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("moveTo", e.FullPath, obj)
+		safeClose(ch)
+	}
+	e.Call("moveTo", target, nil, success, fail)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	e.Call("moveTo", target, success, fail)
-	<-ch
 	return
 }
 
 // Remove removes the specified file or directory. You can only remove directories which are empty.
-func (e *Entry) Remove() (err error) {
+func (e *Entry) Remove() error {
+	return e.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove but returns ctx.Err() if ctx is done before the plugin answers.
+func (e *Entry) RemoveContext(ctx context.Context) (err error) {
 	ch := make(chan struct{})
 	success := func() {
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("remove", e.FullPath, obj)
+		safeClose(ch)
 	}
 	e.Call("remove", success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	return
 }
 
 // Read returns all directory entries.
-func (d *DirectoryEntry) Read() (res []*Entry, err error) {
+func (d *DirectoryEntry) Read() ([]*Entry, error) {
+	return d.ReadContext(context.Background())
+}
+
+// ReadContext is like Read but returns ctx.Err() if ctx is done before the plugin answers.
+func (d *DirectoryEntry) ReadContext(ctx context.Context) (res []*Entry, err error) {
 	ch := make(chan struct{})
 	success := func(entries []*Entry) {
 		res = entries
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("readEntries", d.FullPath, obj)
+		safeClose(ch)
 	}
 	reader := d.Call("createReader")
 	reader.Call("readEntries", success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
 // GetDirectory returns a DirectoryEntry instance corresponding to a directory contained somewhere within the directory subtree
 // rooted at the directory on which it's called.
-func (d *DirectoryEntry) GetDirectory(path string, fl *Flags) (res *DirectoryEntry, err error) {
+func (d *DirectoryEntry) GetDirectory(path string, fl *Flags) (*DirectoryEntry, error) {
+	return d.GetDirectoryContext(context.Background(), path, fl)
+}
+
+// GetDirectoryContext is like GetDirectory but returns ctx.Err() if ctx is done before the plugin answers.
+func (d *DirectoryEntry) GetDirectoryContext(ctx context.Context, path string, fl *Flags) (res *DirectoryEntry, err error) {
 	ch := make(chan struct{})
 	success := func(de *DirectoryEntry) {
 		res = de
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("getDirectory", childPath(d.FullPath, path), obj)
+		safeClose(ch)
 	}
 	d.Call("getDirectory", path, fl.jsObject(), success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
 // GetFile returns a FileEntry instance corresponding to a file contained somewhere within the directory subtree
 // rooted at the directory on which it's called.
-func (d *DirectoryEntry) GetFile(path string, fl *Flags) (res *FileEntry, err error) {
+func (d *DirectoryEntry) GetFile(path string, fl *Flags) (*FileEntry, error) {
+	return d.GetFileContext(context.Background(), path, fl)
+}
+
+// GetFileContext is like GetFile but returns ctx.Err() if ctx is done before the plugin answers.
+func (d *DirectoryEntry) GetFileContext(ctx context.Context, path string, fl *Flags) (res *FileEntry, err error) {
 	ch := make(chan struct{})
 	success := func(fe *FileEntry) {
 		res = fe
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("getFile", childPath(d.FullPath, path), obj)
+		safeClose(ch)
 	}
 	d.Call("getFile", path, fl.jsObject(), success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
-func (f *FileEntry) createWriter() (res *js.Object, err error) {
+func (f *FileEntry) createWriter(ctx context.Context) (res *js.Object, err error) {
 	ch := make(chan struct{})
 	success := func(ob *js.Object) {
 		res = ob
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("createWriter", f.FullPath, obj)
+		safeClose(ch)
 	}
 	f.Call("createWriter", success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
-func (f *FileEntry) file() (res *js.Object) {
+func (f *FileEntry) file(ctx context.Context) (res *js.Object, err error) {
 	ch := make(chan struct{})
 	success := func(ob *js.Object) {
 		res = ob
-		close(ch)
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("file", f.FullPath, obj)
+		safeClose(ch)
+	}
+	f.Call("file", success, fail)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	f.Call("file", success)
-	<-ch
 	return
 }
 
-func (f *FileEntry) Write(data []byte) (err error) {
-	writer, err := f.createWriter()
+// Write replaces the file content with data.
+func (f *FileEntry) Write(data []byte) error {
+	return f.WriteContext(context.Background(), data)
+}
+
+// WriteContext is like Write but returns ctx.Err() if ctx is done before the write ends.
+// The pending write is aborted in that case.
+func (f *FileEntry) WriteContext(ctx context.Context, data []byte) error {
+	writer, err := f.createWriter(ctx)
 	if err != nil {
 		return err
 	}
-	ch := make(chan struct{})
-	success := func() {
-		close(ch)
+	if err := writeBlob(ctx, f.FullPath, writer, newBlob(data)); err != nil {
+		return err
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	if writer.Get("length").Int() > len(data) {
+		return truncateWriter(ctx, f.FullPath, writer, int64(len(data)))
 	}
-	writer.Set("onwriteend", success)
-	writer.Set("onerror", fail)
-	buffer := js.Global.Get("Uint8Array").New(data).Get("buffer")
-	blob := js.Global.Get("Blob").New([]*js.Object{buffer}, map[string]interface{}{"type": ""})
-	writer.Call("write", blob)
-	<-ch
-	return
+	return nil
 }
 
-func (f *FileEntry) Read() (res []byte, err error) {
+// WriteAt writes data starting at byte offset off, leaving the rest of the file untouched.
+// Writing beyond the end of file fills the gap with zeros.
+func (f *FileEntry) WriteAt(data []byte, off int64) (int, error) {
+	fh, err := f.openFile(modeWrite)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	return fh.WriteAt(data, off)
+}
+
+// AppendData writes data at the end of the file.
+func (f *FileEntry) AppendData(data []byte) error {
+	fh, err := f.Append()
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, err = fh.Write(data)
+	return err
+}
+
+// Truncate changes the file length to size.
+func (f *FileEntry) Truncate(size int64) error {
+	fh, err := f.openFile(modeWrite)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	return fh.Truncate(size)
+}
+
+// Read returns the whole file content.
+func (f *FileEntry) Read() ([]byte, error) {
+	return f.ReadContext(context.Background())
+}
+
+// ReadContext is like Read but returns ctx.Err() if ctx is done before the read ends.
+// The pending read is aborted in that case.
+func (f *FileEntry) ReadContext(ctx context.Context) (res []byte, err error) {
+	blob, err := f.file(ctx)
+	if err != nil {
+		return nil, err
+	}
 	reader := js.Global.Get("FileReader").New()
-	blob := f.file()
 	ch := make(chan struct{})
 	success := func() {
 		arrayBuffer := reader.Get("result")
 		res = js.Global.Get("Uint8Array").New(arrayBuffer).Interface().([]byte)
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("readAsArrayBuffer", f.FullPath, obj)
+		safeClose(ch)
 	}
 	reader.Set("onloadend", success)
 	reader.Set("onerror", fail)
 	reader.Call("readAsArrayBuffer", blob)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		reader.Call("abort")
+		return nil, ctx.Err()
+	}
 	return
 }
 
@@ -420,35 +625,53 @@ func (e *Entry) ToURL() (res string) {
 }
 
 // ResolveLocalFileSystemURL retrieves a Entry instance based on it's local URL
-func ResolveLocalFileSystemURL(url string) (res *Entry, err error) {
+func ResolveLocalFileSystemURL(url string) (*Entry, error) {
+	return ResolveLocalFileSystemURLContext(context.Background(), url)
+}
+
+// ResolveLocalFileSystemURLContext is like ResolveLocalFileSystemURL but returns ctx.Err() if ctx is done before the plugin answers.
+func ResolveLocalFileSystemURLContext(ctx context.Context, url string) (res *Entry, err error) {
 	ch := make(chan struct{})
 	success := func(ob *js.Object) {
 		res = &Entry{Object: ob}
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("resolveLocalFileSystemURL", url, obj)
+		safeClose(ch)
 	}
 	js.Global.Call("resolveLocalFileSystemURL", url, success, fail)
-	<-ch
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return
 }
 
 // RequestFileSystem requests a file system where data should be stored.
 // typ is the storage type of the file system.
 // size is the storage space—in bytes—that you need for your app.
-func RequestFileSystem(typ int, size int) (res *FileSystem, err error) {
+func RequestFileSystem(typ FileSystemType, size int) (*FileSystem, error) {
+	return RequestFileSystemContext(context.Background(), typ, size)
+}
+
+// RequestFileSystemContext is like RequestFileSystem but returns ctx.Err() if ctx is done before the plugin answers.
+func RequestFileSystemContext(ctx context.Context, typ FileSystemType, size int) (res *FileSystem, err error) {
 	ch := make(chan struct{})
 	success := func(ob *js.Object) {
 		res = &FileSystem{Object: ob}
-		close(ch)
+		safeClose(ch)
 	}
-	fail := func(e *FileError) {
-		err = e.Error()
-		close(ch)
+	fail := func(obj *js.Object) {
+		err = newFileError("requestFileSystem", "", obj)
+		safeClose(ch)
+	}
+	js.Global.Call("requestFileSystem", int(typ), size, success, fail)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	js.Global.Call("requestFileSystem", typ, size, success, fail)
-	<-ch
 	return
 }
@@ -0,0 +1,236 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// fileInfo implements fs.FileInfo on top of entry metadata.
+type fileInfo struct {
+	entry   *Entry
+	size    int64
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.entry.Name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.entry.IsDirectory }
+func (fi *fileInfo) Sys() interface{}   { return fi.entry }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.entry.IsDirectory {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func statEntry(e *Entry) (*fileInfo, error) {
+	md, err := e.GetMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{entry: e, size: md.Size(), modTime: md.ModTime()}, nil
+}
+
+// Stat returns a fs.FileInfo describing the entry. Its Sys method returns the *Entry.
+func (e *Entry) Stat() (fs.FileInfo, error) {
+	return statEntry(e)
+}
+
+// dirEntry implements fs.DirEntry.
+type dirEntry struct {
+	entry *Entry
+}
+
+func (de *dirEntry) Name() string { return de.entry.Name }
+func (de *dirEntry) IsDir() bool  { return de.entry.IsDirectory }
+
+func (de *dirEntry) Type() fs.FileMode {
+	if de.entry.IsDirectory {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (de *dirEntry) Info() (fs.FileInfo, error) {
+	return statEntry(de.entry)
+}
+
+// Stat returns a fs.FileInfo describing the file.
+func (fh *File) Stat() (fs.FileInfo, error) {
+	if fh.closed {
+		return nil, ErrClosed
+	}
+	return statEntry(fh.entry.Entry)
+}
+
+// dirFile is the fs.ReadDirFile returned when opening a directory.
+type dirFile struct {
+	entry   *DirectoryEntry
+	entries []fs.DirEntry
+	read    bool
+	closed  bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	if d.closed {
+		return nil, ErrClosed
+	}
+	return statEntry(d.entry.Entry)
+}
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.Name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error {
+	if d.closed {
+		return ErrClosed
+	}
+	d.closed = true
+	return nil
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if !d.read {
+		entries, err := readDirEntries(d.entry)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	if n <= 0 {
+		res := d.entries
+		d.entries = nil
+		return res, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	res := d.entries[:n]
+	d.entries = d.entries[n:]
+	return res, nil
+}
+
+func readDirEntries(d *DirectoryEntry) ([]fs.DirEntry, error) {
+	entries, err := d.Read()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		res[i] = &dirEntry{entry: e}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	return res, nil
+}
+
+// dirFS implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+type dirFS struct {
+	root *DirectoryEntry
+}
+
+// FS returns a file system (an fs.FS) for the tree of files rooted at the directory root.
+// The returned value also implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+func FS(root *DirectoryEntry) fs.FS {
+	return &dirFS{root: root}
+}
+
+// fsError maps plugin errors to the io/fs error values where possible.
+func fsError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = fs.ErrNotExist
+	case errors.Is(err, ErrPathExists):
+		err = fs.ErrExist
+	case errors.Is(err, ErrSecurity), errors.Is(err, ErrNoModificationAllowed):
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (fsys *dirFS) lookup(op, name string) (*Entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return fsys.root.Entry, nil
+	}
+	fe, err := fsys.root.GetFile(name, nil)
+	if err == nil {
+		return fe.Entry, nil
+	}
+	de, derr := fsys.root.GetDirectory(name, nil)
+	if derr == nil {
+		return de.Entry, nil
+	}
+	return nil, fsError(op, name, err)
+}
+
+func (fsys *dirFS) Open(name string) (fs.File, error) {
+	e, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDirectory {
+		return &dirFile{entry: e.AsDirectoryEntry()}, nil
+	}
+	fh, err := e.AsFileEntry().Open()
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+	return fh, nil
+}
+
+func (fsys *dirFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := statEntry(e)
+	if err != nil {
+		return nil, fsError("stat", name, err)
+	}
+	return fi, nil
+}
+
+func (fsys *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDirectory {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := readDirEntries(e.AsDirectoryEntry())
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+func (fsys *dirFS) ReadFile(name string) ([]byte, error) {
+	e, err := fsys.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDirectory {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := e.AsFileEntry().Read()
+	if err != nil {
+		return nil, fsError("read", name, err)
+	}
+	return data, nil
+}
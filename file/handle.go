@@ -0,0 +1,316 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// ErrClosed is returned by File methods called after Close.
+var ErrClosed = errors.New("File closed error")
+
+const (
+	modeRead = 1 << iota
+	modeWrite
+	modeAppend
+)
+
+// File is an open handle to a FileEntry, similar to *os.File.
+// Reads are served by slicing the underlying Blob and writes go through a FileWriter,
+// so the file content never has to fit in memory at once.
+//
+// File implements io.Reader, io.Writer, io.Seeker, io.ReaderAt, io.WriterAt and io.Closer.
+type File struct {
+	entry  *FileEntry
+	mode   int
+	offset int64
+	blob   *js.Object
+	writer *js.Object
+	closed bool
+}
+
+// Open opens the file for reading.
+func (f *FileEntry) Open() (*File, error) {
+	return f.openFile(modeRead)
+}
+
+// Create opens the file for reading and writing, truncating it to zero length.
+func (f *FileEntry) Create() (*File, error) {
+	fh, err := f.openFile(modeRead | modeWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := fh.Truncate(0); err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+// Append opens the file for writing. Every write is appended at the end of the file.
+func (f *FileEntry) Append() (*File, error) {
+	return f.openFile(modeWrite | modeAppend)
+}
+
+func (f *FileEntry) openFile(mode int) (fh *File, err error) {
+	fh = &File{entry: f, mode: mode}
+	if mode&modeWrite != 0 {
+		if fh.writer, err = f.createWriter(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return fh, nil
+}
+
+// Entry returns the FileEntry the handle was opened from.
+func (fh *File) Entry() *FileEntry {
+	return fh.entry
+}
+
+func (fh *File) getBlob() (blob *js.Object, err error) {
+	if fh.blob == nil {
+		if fh.blob, err = fh.entry.file(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return fh.blob, nil
+}
+
+// Size returns the current file length.
+func (fh *File) Size() (int64, error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	if fh.writer != nil {
+		return fh.writer.Get("length").Int64(), nil
+	}
+	blob, err := fh.getBlob()
+	if err != nil {
+		return 0, err
+	}
+	return blob.Get("size").Int64(), nil
+}
+
+func (fh *File) readAt(p []byte, off int64) (n int, err error) {
+	blob, err := fh.getBlob()
+	if err != nil {
+		return 0, err
+	}
+	size := blob.Get("size").Int64()
+	if off >= size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > size {
+		end = size
+	}
+	data, err := readBlob(fh.entry.FullPath, blob.Call("slice", off, end))
+	if err != nil {
+		return 0, err
+	}
+	n = copy(p, data)
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// Read reads up to len(p) bytes from the current offset. At end of file it returns 0, io.EOF.
+func (fh *File) Read(p []byte) (n int, err error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	if fh.mode&modeRead == 0 {
+		return 0, ErrNotReadable
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err = fh.readAt(p, fh.offset)
+	fh.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// ReadAt reads len(p) bytes starting at byte offset off. It does not change the current offset.
+func (fh *File) ReadAt(p []byte, off int64) (int, error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	if fh.mode&modeRead == 0 {
+		return 0, ErrNotReadable
+	}
+	if off < 0 {
+		return 0, errors.New("Negative offset error")
+	}
+	return fh.readAt(p, off)
+}
+
+// Write writes p at the current offset (or at the end of file for handles returned by Append).
+// Writing beyond the end of file fills the gap with zeros.
+func (fh *File) Write(p []byte) (n int, err error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	if fh.mode&modeWrite == 0 {
+		return 0, ErrNoModificationAllowed
+	}
+	if fh.mode&modeAppend != 0 {
+		fh.offset = fh.writer.Get("length").Int64()
+	}
+	if n, err = fh.writeAt(p, fh.offset); err != nil {
+		return
+	}
+	fh.offset += int64(n)
+	return
+}
+
+// WriteAt writes p starting at byte offset off. It does not change the current offset.
+func (fh *File) WriteAt(p []byte, off int64) (int, error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	if fh.mode&modeWrite == 0 {
+		return 0, ErrNoModificationAllowed
+	}
+	if fh.mode&modeAppend != 0 {
+		return 0, errors.New("WriteAt in append mode error")
+	}
+	if off < 0 {
+		return 0, errors.New("Negative offset error")
+	}
+	return fh.writeAt(p, off)
+}
+
+func (fh *File) writeAt(p []byte, off int64) (int, error) {
+	length := fh.writer.Get("length").Int64()
+	data := p
+	if off > length {
+		data = append(make([]byte, off-length), p...)
+		off = length
+	}
+	fh.blob = nil
+	fh.writer.Call("seek", off)
+	if err := writeBlob(context.Background(), fh.entry.FullPath, fh.writer, newBlob(data)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Seek sets the offset for the next Read or Write, interpreted according to whence (see io.Seeker).
+func (fh *File) Seek(offset int64, whence int) (int64, error) {
+	if fh.closed {
+		return 0, ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fh.offset
+	case io.SeekEnd:
+		size, err := fh.Size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, errors.New("Invalid whence error")
+	}
+	if offset < 0 {
+		return 0, errors.New("Negative offset error")
+	}
+	fh.offset = offset
+	return offset, nil
+}
+
+// Truncate changes the file length to size. The current offset is not modified.
+func (fh *File) Truncate(size int64) error {
+	if fh.closed {
+		return ErrClosed
+	}
+	if fh.mode&modeWrite == 0 {
+		return ErrNoModificationAllowed
+	}
+	fh.blob = nil
+	return truncateWriter(context.Background(), fh.entry.FullPath, fh.writer, size)
+}
+
+// Close closes the handle. Further operations return ErrClosed.
+func (fh *File) Close() error {
+	if fh.closed {
+		return ErrClosed
+	}
+	fh.closed = true
+	fh.blob = nil
+	fh.writer = nil
+	return nil
+}
+
+func newBlob(data []byte) *js.Object {
+	buffer := js.Global.Get("Uint8Array").New(data).Get("buffer")
+	return js.Global.Get("Blob").New([]*js.Object{buffer}, map[string]interface{}{"type": ""})
+}
+
+func readBlob(path string, blob *js.Object) (res []byte, err error) {
+	reader := js.Global.Get("FileReader").New()
+	ch := make(chan struct{})
+	success := func() {
+		res = js.Global.Get("Uint8Array").New(reader.Get("result")).Interface().([]byte)
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("readAsArrayBuffer", path, obj)
+		safeClose(ch)
+	}
+	reader.Set("onload", success)
+	reader.Set("onerror", fail)
+	reader.Call("readAsArrayBuffer", blob)
+	<-ch
+	return
+}
+
+// writeBlob writes blob at the writer position. The write is aborted if ctx is done first.
+func writeBlob(ctx context.Context, path string, writer *js.Object, blob *js.Object) (err error) {
+	ch := make(chan struct{})
+	success := func() {
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("write", path, obj)
+		safeClose(ch)
+	}
+	writer.Set("onwriteend", success)
+	writer.Set("onerror", fail)
+	writer.Call("write", blob)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		writer.Call("abort")
+		return ctx.Err()
+	}
+	return
+}
+
+// truncateWriter changes the file length to size. The truncation is aborted if ctx is done first.
+func truncateWriter(ctx context.Context, path string, writer *js.Object, size int64) (err error) {
+	ch := make(chan struct{})
+	success := func() {
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("truncate", path, obj)
+		safeClose(ch)
+	}
+	writer.Set("onwriteend", success)
+	writer.Set("onerror", fail)
+	writer.Call("truncate", size)
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		writer.Call("abort")
+		return ctx.Err()
+	}
+	return
+}
@@ -0,0 +1,314 @@
+// Package logsink persists logs on the device using the cordova file plugin.
+//
+// Sink implements io.Writer, so it can be used with log.SetOutput or slog.NewJSONHandler.
+// Writes are buffered in memory and appended to the current log file by a background goroutine;
+// log files are rotated by size and age, keeping at most Options.MaxFiles of them.
+//
+// Install plugin:
+//  cordova plugin add cordova-plugin-file
+package logsink
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jaracil/goco/file"
+)
+
+// ErrClosed is returned when writing to a closed Sink.
+var ErrClosed = errors.New("Log sink closed error")
+
+const timeLayout = "20060102T150405.000"
+
+// Options configures a Sink. Zero values select the defaults.
+type Options struct {
+	// Dir is the directory holding the log files. Defaults to a "logs" directory inside file.Dir.DataDirectory.
+	Dir *file.DirectoryEntry
+	// Prefix of log file names. Defaults to "app".
+	Prefix string
+	// MaxSize is the size in bytes after which the current file is rotated. Defaults to 1MB.
+	MaxSize int64
+	// MaxAge is the age after which the current file is rotated. Zero disables age rotation.
+	MaxAge time.Duration
+	// MaxFiles is the maximum number of log files kept. Defaults to 5.
+	MaxFiles int
+	// BufferSize is the buffered amount of bytes that triggers a flush. Defaults to 4KB.
+	BufferSize int
+	// FlushInterval is the maximum time written data stays in memory. Defaults to 5 seconds.
+	FlushInterval time.Duration
+	// MaxBuffer bounds the data kept in memory while writes to the file fail. Beyond it the oldest
+	// data is dropped, see Sink.Dropped. Defaults to 64 times BufferSize.
+	MaxBuffer int
+}
+
+// Sink is a rotating log file writer.
+type Sink struct {
+	opts Options
+
+	mu      sync.Mutex // guards the fields below
+	buf     []byte
+	closed  bool
+	dropped int64
+
+	ioMu     sync.Mutex // serializes file operations
+	cur      *file.FileEntry
+	curSize  int64
+	curStart time.Time
+
+	kick chan struct{}
+	done chan struct{}
+}
+
+// New opens a Sink, appending to the newest existing log file when it is within the rotation limits.
+func New(opts Options) (*Sink, error) {
+	if opts.Dir == nil {
+		if file.Dir == nil {
+			return nil, errors.New("Log sink error: file plugin not ready")
+		}
+		e, err := file.ResolveLocalFileSystemURL(file.Dir.DataDirectory)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Dir, err = e.AsDirectoryEntry().MkdirAll("logs"); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "app"
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 1 << 20
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = 5
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 4 << 10
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.MaxBuffer < opts.BufferSize {
+		opts.MaxBuffer = 64 * opts.BufferSize
+	}
+	s := &Sink{
+		opts: opts,
+		kick: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		last := files[len(files)-1]
+		md, err := last.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		s.cur = last.AsFileEntry()
+		s.curSize = md.Size()
+		s.curStart, _ = time.Parse(timeLayout, s.stamp(last.Name))
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Write buffers p for the background flusher. It never blocks on file operations,
+// so it is safe to call from JS callbacks.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrClosed
+	}
+	s.buf = append(s.buf, p...)
+	s.trim()
+	full := len(s.buf) >= s.opts.BufferSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (s *Sink) loop() {
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.kick:
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		s.Flush()
+	}
+}
+
+// Flush appends the buffered data to the current log file, rotating it first if needed.
+// On failure the data is kept in the buffer for the next flush, within MaxBuffer.
+func (s *Sink) Flush() error {
+	s.ioMu.Lock()
+	defer s.ioMu.Unlock()
+	return s.flush()
+}
+
+func (s *Sink) flush() error {
+	s.mu.Lock()
+	data := s.buf
+	s.buf = nil
+	s.mu.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+	err := s.rotateIfNeeded(int64(len(data)))
+	if err == nil {
+		err = s.cur.AppendData(data)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.buf = append(data, s.buf...)
+		s.trim()
+		s.mu.Unlock()
+		return err
+	}
+	s.curSize += int64(len(data))
+	return nil
+}
+
+// trim drops the oldest buffered data beyond MaxBuffer, up to the end of a line when there is one.
+// s.mu must be held.
+func (s *Sink) trim() {
+	over := len(s.buf) - s.opts.MaxBuffer
+	if over <= 0 {
+		return
+	}
+	if i := bytes.IndexByte(s.buf[over:], '\n'); i >= 0 {
+		over += i + 1
+	}
+	s.dropped += int64(over)
+	s.buf = append([]byte(nil), s.buf[over:]...)
+}
+
+// Dropped returns the number of bytes discarded because the buffer exceeded MaxBuffer.
+func (s *Sink) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Sink) rotateIfNeeded(n int64) error {
+	switch {
+	case s.cur == nil:
+	case s.curSize > 0 && s.curSize+n > s.opts.MaxSize:
+	case s.opts.MaxAge > 0 && time.Since(s.curStart) > s.opts.MaxAge:
+	default:
+		return nil
+	}
+	return s.rotate()
+}
+
+// Rotate flushes the buffered data and starts a new log file.
+func (s *Sink) Rotate() error {
+	s.ioMu.Lock()
+	defer s.ioMu.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.rotate()
+}
+
+func (s *Sink) rotate() error {
+	now := time.Now().UTC()
+	fe, err := s.opts.Dir.GetFile(s.opts.Prefix+"-"+now.Format(timeLayout)+".log", &file.Flags{Create: true})
+	if err != nil {
+		return err
+	}
+	s.cur = fe
+	s.curSize = 0
+	s.curStart = now
+	return s.prune()
+}
+
+// prune removes the oldest log files beyond MaxFiles.
+func (s *Sink) prune() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for len(files) > s.opts.MaxFiles {
+		if err := files[0].Remove(); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// stamp returns the timestamp part of a log file name, or "" if name is not a log file of this sink.
+func (s *Sink) stamp(name string) string {
+	prefix := s.opts.Prefix + "-"
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".log") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".log")
+}
+
+// files returns the log files of this sink, oldest first.
+func (s *Sink) files() ([]*file.Entry, error) {
+	entries, err := s.opts.Dir.Read()
+	if err != nil {
+		return nil, err
+	}
+	res := []*file.Entry{}
+	for _, e := range entries {
+		if e.IsFile && s.stamp(e.Name) != "" {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Export flushes the buffered data and returns the content of all log files concatenated, oldest first.
+func (s *Sink) Export() ([]byte, error) {
+	s.ioMu.Lock()
+	defer s.ioMu.Unlock()
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	res := []byte{}
+	for _, e := range files {
+		data, err := e.AsFileEntry().Read()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data...)
+	}
+	return res, nil
+}
+
+// Close stops the background flusher and flushes the buffered data. Further writes return ErrClosed.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.done)
+	return s.Flush()
+}
@@ -0,0 +1,29 @@
+package logsink
+
+import (
+	"testing"
+)
+
+func TestWriteMaxBuffer(t *testing.T) {
+	s := &Sink{opts: Options{BufferSize: 1 << 20, MaxBuffer: 16}, kick: make(chan struct{}, 1)}
+	for _, line := range []string{"first line\n", "second line\n", "third\n"} {
+		if _, err := s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The oldest data goes first, cut at the end of a line.
+	if got := string(s.buf); got != "third\n" {
+		t.Fatalf("buffer %q, want %q", got, "third\n")
+	}
+	if d := s.Dropped(); d != 23 {
+		t.Fatalf("dropped %d, want 23", d)
+	}
+	s.Write([]byte("0123456789abcdefXYZ"))
+	// Without a line end the cut is exact.
+	if got := string(s.buf); len(got) != 16 || got != "3456789abcdefXYZ" {
+		t.Fatalf("buffer %q", got)
+	}
+	if d := s.Dropped(); d != 32 {
+		t.Fatalf("dropped %d, want 32", d)
+	}
+}
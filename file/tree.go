@@ -0,0 +1,206 @@
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// TreeError is returned by recursive operations that keep going after a failure on a single entry.
+// It holds one fs.PathError per failed entry.
+type TreeError struct {
+	Errors []*fs.PathError
+}
+
+func (te *TreeError) Error() string {
+	if len(te.Errors) == 1 {
+		return te.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d errors, first: %v", len(te.Errors), te.Errors[0])
+}
+
+// Unwrap returns the per-entry errors.
+func (te *TreeError) Unwrap() []error {
+	res := make([]error, len(te.Errors))
+	for i, e := range te.Errors {
+		res[i] = e
+	}
+	return res
+}
+
+func (te *TreeError) add(op, path string, err error) {
+	if ce, ok := err.(*TreeError); ok {
+		te.Errors = append(te.Errors, ce.Errors...)
+		return
+	}
+	te.Errors = append(te.Errors, &fs.PathError{Op: op, Path: path, Err: err})
+}
+
+func (te *TreeError) err() error {
+	if len(te.Errors) == 0 {
+		return nil
+	}
+	return te
+}
+
+// WalkFunc is the type of the function called by Walk for each entry.
+// If there was a problem reading a directory, Walk calls it a second time for that directory with err set.
+// Returning fs.SkipDir from a directory skips its content, and from a file skips the remaining entries of its parent.
+// Returning any other error stops the walk.
+type WalkFunc func(e *Entry, err error) error
+
+// Walk walks the directory tree rooted at d (d included), calling fn for each entry in lexical order.
+func (d *DirectoryEntry) Walk(fn WalkFunc) error {
+	err := walk(d.Entry, fn)
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(e *Entry, fn WalkFunc) error {
+	if err := fn(e, nil); err != nil || !e.IsDirectory {
+		return err
+	}
+	entries, err := e.AsDirectoryEntry().Read()
+	if err != nil {
+		return fn(e, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, child := range entries {
+		if err := walk(child, fn); err != nil {
+			if err == fs.SkipDir && child.IsDirectory {
+				continue
+			}
+			if err == fs.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveAll removes the directory and all of its content.
+func (d *DirectoryEntry) RemoveAll() (err error) {
+	ch := make(chan struct{})
+	success := func() {
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("removeRecursively", d.FullPath, obj)
+		safeClose(ch)
+	}
+	d.Call("removeRecursively", success, fail)
+	<-ch
+	return
+}
+
+// MkdirAll creates the directory path relative to d, along with any missing parents,
+// and returns the last one. Existing directories are left untouched.
+func (d *DirectoryEntry) MkdirAll(path string) (res *DirectoryEntry, err error) {
+	res = d
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if res, err = res.GetDirectory(name, &Flags{Create: true}); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// DiskUsage returns the sum of the sizes of all files in the tree rooted at d.
+func (d *DirectoryEntry) DiskUsage() (total int64, err error) {
+	err = d.Walk(func(e *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsFile {
+			md, err := e.GetMetadata()
+			if err != nil {
+				return err
+			}
+			total += md.Size()
+		}
+		return nil
+	})
+	return
+}
+
+// CopyTree copies the tree rooted at d into the directory dst under the given name,
+// creating or merging into dst/name. Entries that fail to copy are skipped and reported in a *TreeError.
+// A dst inside d (or d itself) is rejected with ErrInvalidModification.
+func (d *DirectoryEntry) CopyTree(dst *DirectoryEntry, name string) (*DirectoryEntry, error) {
+	if isInside(dst.FileSystem.Name, dst.FullPath, d.FileSystem.Name, d.FullPath) {
+		return nil, &fs.PathError{Op: "copy", Path: dst.FullPath, Err: ErrInvalidModification}
+	}
+	target, err := dst.GetDirectory(name, &Flags{Create: true})
+	if err != nil {
+		return nil, err
+	}
+	te := &TreeError{}
+	entries, err := d.Read()
+	if err != nil {
+		te.add("read", d.FullPath, err)
+		return target, te
+	}
+	for _, child := range entries {
+		if child.IsDirectory {
+			if _, err := child.AsDirectoryEntry().CopyTree(target, child.Name); err != nil {
+				te.add("copy", child.FullPath, err)
+			}
+			continue
+		}
+		if _, err := child.copyTo(target, child.Name); err != nil {
+			te.add("copy", child.FullPath, err)
+		}
+	}
+	return target, te.err()
+}
+
+// MoveTree moves the tree rooted at d into the directory dst under the given name.
+// It copies the tree first and removes the source only when every entry was copied,
+// so on a *TreeError the source is left intact.
+func (d *DirectoryEntry) MoveTree(dst *DirectoryEntry, name string) (*DirectoryEntry, error) {
+	target, err := d.CopyTree(dst, name)
+	if err != nil {
+		return target, err
+	}
+	if err := d.RemoveAll(); err != nil {
+		return target, err
+	}
+	return target, nil
+}
+
+// copyTo copies the entry into the parent directory with the given name.
+func (e *Entry) copyTo(parent *DirectoryEntry, name string) (res *Entry, err error) {
+	ch := make(chan struct{})
+	success := func(en *Entry) {
+		res = en
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = newFileError("copyTo", e.FullPath, obj)
+		safeClose(ch)
+	}
+	e.Call("copyTo", parent.Entry, name, success, fail)
+	<-ch
+	return
+}
+
+// isInside returns true if path, in the file system fsys, is dir (in the file system dirFS) or one of its descendants.
+func isInside(fsys, path, dirFS, dir string) bool {
+	if fsys != dirFS {
+		return false
+	}
+	if dir == "/" {
+		return true // Everything in a file system is inside its root
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
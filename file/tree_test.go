@@ -0,0 +1,30 @@
+package file
+
+import "testing"
+
+func TestIsInside(t *testing.T) {
+	tests := []struct {
+		fsys, path, dirFS, dir string
+		want                   bool
+	}{
+		{"files", "/a", "files", "/a", true},
+		{"files", "/a/b", "files", "/a", true},
+		{"files", "/a/b", "files", "/a/", true},
+		{"files", "/ab", "files", "/a", false},
+		{"files", "/b", "files", "/a", false},
+		{"files", "/", "files", "/a", false},
+		// Roots
+		{"files", "/", "files", "/", true},
+		{"files", "/backup", "files", "/", true},
+		{"cache", "/", "files", "/", false},
+		{"cache", "/backup", "files", "/", false},
+		// Other file systems sharing the path prefix
+		{"cache", "/a", "files", "/a", false},
+		{"cache", "/a/b", "files", "/a", false},
+	}
+	for _, tt := range tests {
+		if got := isInside(tt.fsys, tt.path, tt.dirFS, tt.dir); got != tt.want {
+			t.Errorf("isInside(%q, %q, %q, %q) = %v, want %v", tt.fsys, tt.path, tt.dirFS, tt.dir, got, tt.want)
+		}
+	}
+}
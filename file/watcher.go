@@ -0,0 +1,167 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventOp describes a change detected by a Watcher.
+type EventOp int
+
+const (
+	EventCreate EventOp = iota + 1
+	EventModify
+	EventDelete
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case EventCreate:
+		return "create"
+	case EventModify:
+		return "modify"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a change on an entry below the watched directory.
+type Event struct {
+	Op    EventOp
+	Path  string // Full path of the entry
+	Entry *Entry // Entry that changed (last known entry for EventDelete)
+}
+
+// Watcher polls a directory tree and reports changes in entries' ModificationTime and Size.
+type Watcher struct {
+	// Events delivers changes. It is closed after Close.
+	Events chan Event
+	// Errors delivers scan errors. Errors are dropped when nobody is receiving.
+	Errors chan error
+
+	root     *DirectoryEntry
+	interval time.Duration
+	snap     map[string]*entryState
+	done     chan struct{}
+	once     sync.Once
+}
+
+type entryState struct {
+	entry   *Entry
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher scans the tree rooted at root and starts polling it every interval.
+// Changes found after the initial scan are sent to the Events channel. A non-positive interval means one second.
+func NewWatcher(root *DirectoryEntry, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w := &Watcher{
+		Events:   make(chan Event, 64),
+		Errors:   make(chan error, 1),
+		root:     root,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	snap, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.snap = snap
+	go w.loop()
+	return w, nil
+}
+
+// Close stops polling and closes the Events channel.
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+}
+
+func (w *Watcher) loop() {
+	defer close(w.Events)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+		snap, err := w.scan()
+		if err != nil {
+			select {
+			case w.Errors <- err:
+			default:
+			}
+			continue
+		}
+		for _, ev := range diff(w.snap, snap) {
+			select {
+			case w.Events <- ev:
+			case <-w.done:
+				return
+			}
+		}
+		w.snap = snap
+	}
+}
+
+func (w *Watcher) scan() (map[string]*entryState, error) {
+	snap := map[string]*entryState{}
+	err := w.root.Walk(func(e *Entry, err error) error {
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if e.FullPath == w.root.FullPath {
+			return nil
+		}
+		md, err := e.GetMetadata()
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if e.IsDirectory {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		snap[e.FullPath] = &entryState{entry: e, modTime: md.ModTime(), size: md.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// diff returns the events turning snapshot old into cur, sorted by path.
+func diff(old, cur map[string]*entryState) []Event {
+	events := []Event{}
+	for path, st := range cur {
+		prev, ok := old[path]
+		switch {
+		case !ok:
+			events = append(events, Event{Op: EventCreate, Path: path, Entry: st.entry})
+		case !prev.modTime.Equal(st.modTime) || prev.size != st.size:
+			events = append(events, Event{Op: EventModify, Path: path, Entry: st.entry})
+		}
+	}
+	for path, st := range old {
+		if _, ok := cur[path]; !ok {
+			events = append(events, Event{Op: EventDelete, Path: path, Entry: st.entry})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
@@ -0,0 +1,624 @@
+package mqtt
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Will is the message the broker publishes on behalf of the client when the connection is lost unexpectedly.
+type Will struct {
+	Topic   string
+	Payload string
+	Qos     int
+	Retain  bool
+}
+
+// ConnectOptions holds the broker connection parameters accepted by the plugin connect call.
+type ConnectOptions struct {
+	// URL of the broker, e.g. "tcp://test.mosquitto.org". The scheme may be omitted, then TLS selects it.
+	// The WebSocket transport maps tcp and ssl to ws and wss, and uses the "/mqtt" path unless URL has one.
+	URL  string
+	Port int
+	// ClientID identifies the client on the broker. It may only be empty with a clean session.
+	ClientID string
+	// TLS selects "ssl://" instead of "tcp://" when URL has no scheme.
+	TLS      bool
+	Username string
+	Password string
+	// KeepAlive is the maximum silence period before a ping is sent. Zero keeps the plugin default.
+	KeepAlive time.Duration
+	// ConnectionTimeout bounds the connection attempt. Zero keeps the plugin default.
+	ConnectionTimeout time.Duration
+	// PersistentSession asks the broker to keep the session (subscriptions and queued QoS 1/2 messages)
+	// across connections. It is sent as cleanSession = !PersistentSession.
+	PersistentSession bool
+	// Will is the optional last will message.
+	Will *Will
+	// BinaryPayload makes the plugin exchange payloads base64 encoded, so PublishBytes and
+	// received messages carry arbitrary bytes. Otherwise payloads must be UTF-8 text.
+	BinaryPayload bool
+	// AutoReconnect makes the client reconnect and restore its subscriptions when the connection is lost.
+	AutoReconnect bool
+	// MinReconnectDelay is the first reconnection delay, doubled on every failed attempt. Defaults to 1 second.
+	MinReconnectDelay time.Duration
+	// MaxReconnectDelay caps the reconnection delay. Defaults to 2 minutes.
+	MaxReconnectDelay time.Duration
+}
+
+// Validate checks opts against the MQTT 3.1.1 rules, returning an error wrapping ErrInvalidOptions.
+func (opts *ConnectOptions) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidOptions, fmt.Sprintf(format, args...))
+	}
+	if opts.URL == "" {
+		return invalid("empty URL")
+	}
+	if i := strings.Index(opts.URL, "://"); i >= 0 {
+		switch scheme := opts.URL[:i]; scheme {
+		case "tcp", "ws":
+			if opts.TLS {
+				return invalid("TLS requested with %q URL", opts.URL)
+			}
+		case "ssl", "wss":
+		default:
+			return invalid("unsupported URL scheme %q", scheme)
+		}
+	}
+	if opts.Port <= 0 || opts.Port > 65535 {
+		return invalid("port %d out of range", opts.Port)
+	}
+	if opts.ClientID == "" && opts.PersistentSession {
+		return invalid("empty client ID requires a clean session")
+	}
+	if len(opts.ClientID) > 65535 {
+		return invalid("client ID too long")
+	}
+	if opts.Password != "" && opts.Username == "" {
+		return invalid("password without username")
+	}
+	if opts.KeepAlive < 0 || opts.KeepAlive > 65535*time.Second {
+		return invalid("keepalive %v out of range", opts.KeepAlive)
+	}
+	if opts.ConnectionTimeout < 0 {
+		return invalid("negative connection timeout")
+	}
+	if w := opts.Will; w != nil {
+		if w.Topic == "" || strings.ContainsAny(w.Topic, "+#") {
+			return invalid("invalid will topic %q", w.Topic)
+		}
+		if w.Qos < 0 || w.Qos > 2 {
+			return invalid("invalid will QoS %d", w.Qos)
+		}
+	}
+	return nil
+}
+
+// brokerURL returns URL with the scheme selected by TLS when it has none.
+func (opts *ConnectOptions) brokerURL() string {
+	if strings.Contains(opts.URL, "://") {
+		return opts.URL
+	}
+	if opts.TLS {
+		return "ssl://" + opts.URL
+	}
+	return "tcp://" + opts.URL
+}
+
+// State is the connection state of a Client.
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+	StateReconnecting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+type subscription struct {
+	qos     int
+	handler func(string)
+	chans   []*Subscription
+}
+
+// Client is a MQTT connection with its own subscriptions.
+// Several clients can be connected at once (e.g. to different brokers) only over the WebSocket transport:
+// the plugin handles a single native connection, so while a client uses it, Connect on another one
+// returns ErrPluginBusy.
+type Client struct {
+	opts ConnectOptions
+
+	mu            sync.Mutex // guards the fields below
+	state         State
+	closing       bool
+	done          chan struct{} // closed by Disconnect to stop reconnecting
+	subs          map[string]*subscription
+	onLost        func(err error)
+	onReconnected func(err error)
+	handler       Handler
+	outbox        *Outbox
+	tr            transport // nil while disconnected
+
+	subMu sync.Mutex // serializes subscribe and unsubscribe calls
+
+	queueMu sync.Mutex // guards the fields below
+	queue   []delivery // messages waiting for their handlers
+	serving bool       // serve is running
+}
+
+// delivery is a received message with the handlers to call.
+type delivery struct {
+	msg      *Message
+	handlers []func(string)
+	h        Handler
+}
+
+// NewClient returns a disconnected client for the broker described by opts.
+// With the plugin installed, only one client can be connected at a time, see Client.
+func NewClient(opts ConnectOptions) *Client {
+	return &Client{
+		opts: opts,
+		subs: map[string]*subscription{},
+	}
+}
+
+// Options returns the client connection options.
+func (c *Client) Options() ConnectOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+// SetOptions replaces the connection options used by the next Connect.
+// It returns ErrAlreadyConnected unless the client is disconnected.
+func (c *Client) SetOptions(opts ConnectOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != StateDisconnected {
+		return ErrAlreadyConnected
+	}
+	c.opts = opts
+	return nil
+}
+
+// State returns the connection state.
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Connected returns true while the client is connected.
+func (c *Client) Connected() bool {
+	return c.State() == StateConnected
+}
+
+// OnConnectionLost sets the function called when the connection drops unexpectedly (before reconnecting).
+func (c *Client) OnConnectionLost(fn func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onLost = fn
+}
+
+// OnReconnected sets the function called after an automatic reconnection.
+// err is non-nil when some subscriptions could not be restored.
+func (c *Client) OnReconnected(fn func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReconnected = fn
+}
+
+// SetHandler sets the handler receiving every message of every subscription (e.g. a *ServeMux),
+// in addition to the function given to SubscribeTopic. Like those functions, it runs on a client goroutine
+// (not on the JS callback reporting the message) one message at a time, so it may block or call Publish;
+// a slow handler delays the next messages.
+func (c *Client) SetHandler(h Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handler = h
+}
+
+// Connect connects to the MQTT server and restores the subscriptions kept from a lost connection.
+// Will return an non-nil error if the options are invalid, plugin is not installed,
+// the plugin is in use by another connected client or there was an error connecting.
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	if c.state != StateDisconnected {
+		c.mu.Unlock()
+		return ErrAlreadyConnected
+	}
+	c.state = StateConnecting
+	c.mu.Unlock()
+	// The options can't change until the state goes back to disconnected.
+	if err := c.opts.Validate(); err != nil {
+		c.setState(StateDisconnected)
+		return err
+	}
+	tr, err := newTransport(c)
+	if err != nil {
+		c.setState(StateDisconnected)
+		return err
+	}
+	if err := tr.connect(&c.opts, c.connectionLost); err != nil {
+		c.setState(StateDisconnected)
+		tr.release()
+		return err
+	}
+	c.mu.Lock()
+	c.tr = tr
+	c.state = StateConnected
+	c.closing = false
+	c.done = make(chan struct{})
+	c.mu.Unlock()
+	err = c.resubscribe()
+	go c.drain()
+	return err
+}
+
+// transport returns the transport of the current connection.
+func (c *Client) transport() (transport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tr == nil {
+		return nil, ErrNotConnected
+	}
+	return c.tr, nil
+}
+
+func (c *Client) setState(st State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = st
+}
+
+// Disconnect disconnects from the connected server (or stops reconnecting). Subscriptions are dropped.
+// It returns ErrConnecting while Connect is in progress.
+func (c *Client) Disconnect() error {
+	c.mu.Lock()
+	st := c.state
+	if st == StateDisconnected || c.closing {
+		c.mu.Unlock()
+		return nil
+	}
+	if st == StateConnecting || c.tr == nil {
+		c.mu.Unlock()
+		return ErrConnecting
+	}
+	c.closing = true
+	close(c.done)
+	tr := c.tr
+	c.mu.Unlock()
+	if st == StateConnected {
+		if err := tr.disconnect(); err != nil {
+			c.mu.Lock()
+			c.closing = false
+			c.done = make(chan struct{})
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.state = StateDisconnected
+	c.closing = false
+	subs := c.subs
+	c.subs = map[string]*subscription{}
+	c.tr = nil
+	c.mu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
+	tr.release()
+	return nil
+}
+
+// connectionLost is called by the plugin (from a JS callback, so it must not block).
+func (c *Client) connectionLost() {
+	c.mu.Lock()
+	if c.state != StateConnected || c.closing {
+		c.mu.Unlock()
+		return
+	}
+	if c.opts.AutoReconnect {
+		c.state = StateReconnecting
+	} else {
+		c.state = StateDisconnected
+	}
+	onLost := c.onLost
+	done := c.done
+	tr := c.tr
+	if !c.opts.AutoReconnect {
+		c.tr = nil
+	}
+	c.mu.Unlock()
+	if !c.opts.AutoReconnect {
+		tr.release()
+	}
+	go func() {
+		if onLost != nil {
+			onLost(ErrConnectionLost)
+		}
+		if c.opts.AutoReconnect {
+			c.reconnect(done)
+		}
+	}()
+}
+
+// reconnect retries the connection with exponential backoff and jitter until it succeeds or done is closed.
+func (c *Client) reconnect(done chan struct{}) {
+	tr, err := c.transport()
+	if err != nil {
+		return
+	}
+	delay := c.opts.MinReconnectDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	max := c.opts.MaxReconnectDelay
+	if max <= 0 {
+		max = 2 * time.Minute
+	}
+	for {
+		select {
+		case <-time.After(delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))):
+		case <-done:
+			return
+		}
+		if err := tr.connect(&c.opts, c.connectionLost); err == nil {
+			break
+		}
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+	c.mu.Lock()
+	select {
+	case <-done:
+		// Disconnect was called while connecting, and already released the transport.
+		// If Connect was called since, the plugin belongs to the new transport and this is a no-op.
+		c.mu.Unlock()
+		tr.disconnect()
+		tr.release()
+		return
+	default:
+	}
+	c.state = StateConnected
+	onReconnected := c.onReconnected
+	c.mu.Unlock()
+	err = c.resubscribe()
+	go c.drain()
+	if onReconnected != nil {
+		onReconnected(err)
+	}
+}
+
+// resubscribe restores every active subscription with its QoS.
+func (c *Client) resubscribe() error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.mu.Lock()
+	subs := map[string]int{}
+	for topic, sub := range c.subs {
+		subs[topic] = sub.qos
+	}
+	tr := c.tr
+	c.mu.Unlock()
+	failed := []string{}
+	for topic, qos := range subs {
+		if err := tr.subscribe(topic, qos); err != nil {
+			failed = append(failed, topic+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrResubscribe, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// SubscribeTopic subscribes to a topic, and calls the function passed as a parameter every time it reads a value from the topic.
+// The function runs on a client goroutine, see SetHandler. The subscription is restored after reconnecting.
+func (c *Client) SubscribeTopic(topic string, qos int, resFunc func(string)) error {
+	if err := ValidateFilter(topic); err != nil {
+		return err
+	}
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	tr, err := c.transport()
+	if err != nil {
+		return err
+	}
+	if err := tr.subscribe(topic, qos); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	sub := c.subs[topic]
+	if sub == nil {
+		sub = &subscription{}
+		c.subs[topic] = sub
+	}
+	sub.qos = qos
+	sub.handler = resFunc
+	c.mu.Unlock()
+	return nil
+}
+
+// UnsubscribeTopic usubscribes and stops reading values from that topic.
+// Subscriptions on the topic are ended too.
+func (c *Client) UnsubscribeTopic(topic string) error {
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.mu.Lock()
+	sub := c.subs[topic]
+	delete(c.subs, topic)
+	tr := c.tr
+	c.mu.Unlock()
+	if sub != nil {
+		sub.close()
+	}
+	if tr == nil {
+		return ErrNotConnected
+	}
+	return tr.unsubscribe(topic)
+}
+
+// Publish sends the data from payload to the topic passed as a parameter on the connected server
+func (c *Client) Publish(topic, payload string, qos int, retain bool) error {
+	return c.PublishBytes(topic, []byte(payload), qos, retain)
+}
+
+// PublishBytes sends a binary payload to the topic on the connected server.
+// With the plugin transport, binary payloads require ConnectOptions.BinaryPayload.
+//
+// When an Outbox is set, QoS 1 and 2 messages published while offline (or while older messages are still queued)
+// are queued and nil is returned; their delivery result is reported through Outbox.OnResult.
+func (c *Client) PublishBytes(topic string, payload []byte, qos int, retain bool) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	if qos < 0 || qos > 2 {
+		return fmt.Errorf("%w: QoS %d", ErrInvalidOptions, qos)
+	}
+	msg := &Message{Topic: topic, Payload: payload, Qos: qos, Retained: retain}
+	c.mu.Lock()
+	ob := c.outbox
+	c.mu.Unlock()
+	connected := c.Connected()
+	if ob != nil && qos > 0 && (!connected || ob.Len() > 0) {
+		if err := ob.push(msg); err != nil {
+			return err
+		}
+		if connected {
+			go c.drain()
+		}
+		return nil
+	}
+	if !connected {
+		return ErrNotConnected
+	}
+	err := c.publish(msg)
+	if err != nil && ob != nil && qos > 0 && !c.Connected() {
+		// The connection dropped while publishing, keep the message for the next connection.
+		return ob.push(msg)
+	}
+	return err
+}
+
+func (c *Client) publish(msg *Message) error {
+	tr, err := c.transport()
+	if err != nil {
+		return err
+	}
+	return tr.publish(msg)
+}
+
+// SetOutbox sets the outbox queuing QoS 1 and 2 messages published while offline.
+func (c *Client) SetOutbox(ob *Outbox) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outbox = ob
+}
+
+// drain publishes the messages queued in the outbox.
+func (c *Client) drain() {
+	c.mu.Lock()
+	ob := c.outbox
+	c.mu.Unlock()
+	if ob != nil {
+		ob.drain(c.publish, c.Connected)
+	}
+}
+
+// dispatch delivers a message received on the subscription filter.
+func (c *Client) dispatch(filter string, msg *Message) {
+	c.deliver(msg, func(f string) bool { return f == filter })
+}
+
+// route delivers a message to every subscription whose filter matches its topic.
+func (c *Client) route(msg *Message) {
+	c.deliver(msg, func(f string) bool { return Match(f, msg.Topic) })
+}
+
+func (c *Client) deliver(msg *Message, match func(filter string) bool) {
+	c.mu.Lock()
+	h := c.handler
+	var chans []*Subscription
+	var handlers []func(string)
+	matched := false
+	for filter, sub := range c.subs {
+		if !match(filter) {
+			continue
+		}
+		matched = true
+		chans = append(chans, sub.chans...)
+		if sub.handler != nil {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mu.Unlock()
+	if !matched {
+		return
+	}
+	for _, s := range chans {
+		s.deliver(msg)
+	}
+	if len(handlers) == 0 && h == nil {
+		return
+	}
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	c.queue = append(c.queue, delivery{msg: msg, handlers: handlers, h: h})
+	if !c.serving {
+		c.serving = true
+		go c.serve()
+	}
+}
+
+// serve calls the handlers of the queued messages in order. Messages arrive on JS callbacks,
+// which can't block, so handlers run here instead.
+func (c *Client) serve() {
+	for {
+		c.queueMu.Lock()
+		if len(c.queue) == 0 {
+			c.serving = false
+			c.queueMu.Unlock()
+			return
+		}
+		d := c.queue[0]
+		c.queue = c.queue[1:]
+		c.queueMu.Unlock()
+		for _, fn := range d.handlers {
+			fn(string(d.msg.Payload))
+		}
+		if d.h != nil {
+			d.h.ServeMQTT(d.msg)
+		}
+	}
+}
+
+// close ends the channel subscriptions of the filter.
+func (sub *subscription) close() {
+	for _, s := range sub.chans {
+		s.close()
+	}
+}
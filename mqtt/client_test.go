@@ -0,0 +1,95 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePlugin is a pluginAPI holding a single native connection, like the plugin.
+type fakePlugin struct {
+	mu          sync.Mutex
+	connects    int
+	disconnects int
+	connected   bool
+	hold        map[int]chan struct{} // connect calls (by number) waiting for their channel
+}
+
+func (p *fakePlugin) available() bool { return true }
+
+func (p *fakePlugin) connect(opts *ConnectOptions, onLost func()) error {
+	p.mu.Lock()
+	p.connects++
+	wait := p.hold[p.connects]
+	p.mu.Unlock()
+	if wait != nil {
+		<-wait
+	}
+	p.mu.Lock()
+	p.connected = true
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *fakePlugin) disconnect() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disconnects++
+	p.connected = false
+	return nil
+}
+
+func (p *fakePlugin) subscribe(filter string, qos int) error  { return nil }
+func (p *fakePlugin) unsubscribe(filter string) error         { return nil }
+func (p *fakePlugin) publish(msg *Message, binary bool) error { return nil }
+
+func (p *fakePlugin) count() (connects, disconnects int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connects, p.disconnects
+}
+
+func usePlugin(t *testing.T, p pluginAPI) {
+	saved := native
+	native = p
+	t.Cleanup(func() { native = saved })
+}
+
+func TestReconnectDisconnectConnect(t *testing.T) {
+	stale := make(chan struct{})
+	p := &fakePlugin{hold: map[int]chan struct{}{2: stale}}
+	usePlugin(t, p)
+	c := NewClient(ConnectOptions{URL: "broker", Port: 1883, ClientID: "test", AutoReconnect: true, MinReconnectDelay: time.Millisecond})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	c.connectionLost()
+	deadline := time.Now().Add(time.Second)
+	for n, _ := p.count(); n < 2; n, _ = p.count() {
+		if time.Now().After(deadline) {
+			t.Fatal("no reconnection attempt")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The reconnection attempt is pending, replace it with a new connection.
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	close(stale)
+	time.Sleep(20 * time.Millisecond)
+	if _, n := p.count(); n != 0 {
+		t.Fatalf("stale reconnection disconnected the plugin %d times", n)
+	}
+	if owner() != c || !c.Connected() {
+		t.Fatalf("owner %p, state %v, want %p connected", owner(), c.State(), c)
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if owner() != nil {
+		t.Fatal("plugin still owned after Disconnect")
+	}
+}
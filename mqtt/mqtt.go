@@ -1,4 +1,6 @@
 // Package mqtt is a GopherJS wrapper for 'CordovaMqTTPlugin'.
+// When the plugin is not installed (e.g. Cordova browser platform), clients speak
+// MQTT 3.1.1 over the browser WebSocket API instead.
 //
 // Install plugin:
 // 	cordova plugin add cordova-plugin-mqtt
@@ -11,6 +13,21 @@ import (
 	"github.com/gopherjs/gopherjs/js"
 )
 
+var (
+	ErrPluginNotFound   = errors.New("Couldn't get 'CordovaMqTTPlugin', make sure plugin is installed")
+	ErrPluginBusy       = errors.New("'CordovaMqTTPlugin' is in use by another client, it supports a single connection")
+	ErrNotConnected     = errors.New("No server connected")
+	ErrAlreadyConnected = errors.New("Client already connected")
+	ErrConnecting       = errors.New("Connection in progress")
+	ErrInvalidOptions   = errors.New("Invalid connect options")
+	ErrConnectionLost   = errors.New("Connection lost")
+	ErrResubscribe      = errors.New("Couldn't restore subscriptions")
+	ErrInvalidTopic     = errors.New("Invalid topic")
+	ErrRefused          = errors.New("Refused by server")
+	ErrProtocol         = errors.New("Protocol error")
+	ErrTimeout          = errors.New("Timeout")
+)
+
 type DisconnectObject struct {
 	*js.Object
 	Success func(obj *js.Object) `js:"success"`
@@ -19,11 +36,27 @@ type DisconnectObject struct {
 
 type Server struct {
 	*js.Object
-	URL      string               `js:"url"`
-	Port     int                  `js:"port"`
-	ClientID string               `js:"clientId"`
-	Success  func(obj *js.Object) `js:"success"`
-	Error    func(obj *js.Object) `js:"error"`
+	URL               string               `js:"url"`
+	Port              int                  `js:"port"`
+	ClientID          string               `js:"clientId"`
+	Username          string               `js:"username"`
+	Password          string               `js:"password"`
+	KeepAlive         int                  `js:"keepAlive"`         // Seconds
+	ConnectionTimeout int                  `js:"connectionTimeout"` // Milliseconds
+	CleanSession      bool                 `js:"cleanSession"`
+	WillTopicConfig   *WillTopicConfig     `js:"willTopicConfig"`
+	OnConnectionLost  func()               `js:"onConnectionLost"`
+	IsBinaryPayload   bool                 `js:"isBinaryPayload"`
+	Success           func(obj *js.Object) `js:"success"`
+	Error             func(obj *js.Object) `js:"error"`
+}
+
+type WillTopicConfig struct {
+	*js.Object
+	Topic   string `js:"topic"`
+	Payload string `js:"payload"`
+	Qos     int    `js:"qos"`
+	Retain  bool   `js:"retain"`
 }
 
 type PublishOBject struct {
@@ -51,151 +84,58 @@ type SusbscribeObject struct {
 	Error   func(obj *js.Object) `js:"error"`
 }
 
-var (
-	instance            *js.Object
-	connectedServer     *Server
-	subscribeTopicCh    = make(chan *SusbscribeObject)
-	subscribeTopicChRes = make(chan error)
-)
-
-func mo() *js.Object {
-	if instance == nil {
-		instance = js.Global.Get("cordova").Get("plugins").Get("CordovaMqTTPlugin")
-	}
-	return instance
+// DefaultClient is the client used by the package level functions.
+var DefaultClient = NewClient(ConnectOptions{})
+
+// Connect connects DefaultClient to a MQTT server, disconnecting it first if it was connected.
+// The other options set on DefaultClient (e.g. AutoReconnect) are kept.
+// Will return an non-nil error if plugin is not installed or there was an error connecting
+func Connect(url string, port int, clientID string) error {
+	opts := DefaultClient.Options()
+	opts.URL = url
+	opts.Port = port
+	opts.ClientID = clientID
+	return ConnectWithOptions(opts)
 }
 
-// Connect connects to a MQTT server. Will return an non-nil error if plugin is not installed or there was an error connecting
-func Connect(url string, port int, clientID string) (err error) {
-	if mo() == nil || mo() == js.Undefined {
-		err = errors.New("Couldn't get 'CordovaMqTTPlugin', make sure plugin is installed")
+// ConnectWithOptions connects DefaultClient with opts, disconnecting it first if it was connected.
+// Callbacks, handler and outbox set on DefaultClient are kept.
+func ConnectWithOptions(opts ConnectOptions) error {
+	if err := DefaultClient.Disconnect(); err != nil {
 		return err
 	}
-	if connectedServer != nil {
-		Disconnect()
-	}
-	server := createServer(url, port, clientID)
-	ch := make(chan error)
-	server.Success = func(obj *js.Object) {
-		connectedServer = server
-		close(ch)
-	}
-	server.Error = func(obj *js.Object) {
-		err = errors.New(obj.String())
-		close(ch)
+	if err := DefaultClient.SetOptions(opts); err != nil {
+		return err
 	}
-
-	mo().Call("connect", server)
-	<-ch
-	go subscribeTopicQueue()
-	return
-}
-
-func createServer(url string, port int, clientID string) *Server {
-	server := &Server{Object: js.Global.Get("Object").New()}
-	server.URL = url
-	server.Port = port
-	server.ClientID = clientID
-	return server
+	return DefaultClient.Connect()
 }
 
-// Disconnect disconnects from the connected server.
-func Disconnect() (err error) {
-	if connectedServer != nil {
-		ch := make(chan error)
-		disc := &DisconnectObject{Object: js.Global.Get("Object").New()}
-		disc.Success = func(obj *js.Object) {
-			connectedServer = nil
-			close(ch)
-		}
-		disc.Error = func(obj *js.Object) {
-			err = errors.New(obj.String())
-			close(ch)
-		}
-		mo().Call("disconnect", disc)
-		<-ch
-	}
-	return
+// Disconnect disconnects DefaultClient from the connected server.
+func Disconnect() error {
+	return DefaultClient.Disconnect()
 }
 
-// SubscribeTopic subscribes to a topic, and calls the function passed as a parameter every time it reads a value from the topic.
+// SubscribeTopic subscribes DefaultClient to a topic, and calls the function passed as a parameter every time it reads a value from the topic.
 func SubscribeTopic(topic string, qos int, resFunc func(string)) error {
-	if connectedServer == nil {
-		return errors.New("No server connected")
-	}
-
-	subs := &SusbscribeObject{Object: js.Global.Get("Object").New()}
-	subs.Topic = topic
-	subs.Qos = qos
-
-	subscribeTopicCh <- subs
-	if err := <-subscribeTopicChRes; err != nil {
-		return err
-	}
-	mo().Call("listen", topic, resFunc)
-	return nil
+	return DefaultClient.SubscribeTopic(topic, qos, resFunc)
 }
 
-func subscribeToTopic(subs *SusbscribeObject) (err error) {
-	ch := make(chan error)
-
-	subs.Success = func(obj *js.Object) {
-		close(ch)
-	}
-	subs.Error = func(obj *js.Object) {
-		err = errors.New(obj.String())
-		close(ch)
-	}
-
-	mo().Call("subscribe", subs)
-	<-ch
-	return
+// Subscribe subscribes DefaultClient to a topic filter, delivering its messages through a channel.
+func Subscribe(topic string, qos int) (*Subscription, error) {
+	return DefaultClient.Subscribe(topic, qos)
 }
 
-func subscribeTopicQueue() {
-	for subscriber := range subscribeTopicCh {
-		subscribeTopicChRes <- subscribeToTopic(subscriber)
-	}
+// PublishBytes sends a binary payload to the topic on the server DefaultClient is connected to.
+func PublishBytes(topic string, payload []byte, qos int, retain bool) error {
+	return DefaultClient.PublishBytes(topic, payload, qos, retain)
 }
 
-// Publish sends the data from payload to the topic passed as a parameter on the connected server
-func Publish(topic, payload string, qos int, retain bool) (err error) {
-	if connectedServer == nil {
-		return errors.New("No server connected")
-	}
-	ch := make(chan error)
-	pub := &PublishOBject{Object: js.Global.Get("Object").New()}
-	pub.Topic = topic
-	pub.Payload = payload
-	pub.Qos = qos
-	pub.Retain = retain
-	pub.Success = func(obj *js.Object) {
-		close(ch)
-	}
-	pub.Error = func(obj *js.Object) {
-		err = errors.New(obj.String())
-		close(ch)
-	}
-	mo().Call("publish", pub)
-	<-ch
-	return
+// Publish sends the data from payload to the topic passed as a parameter on the server DefaultClient is connected to.
+func Publish(topic, payload string, qos int, retain bool) error {
+	return DefaultClient.Publish(topic, payload, qos, retain)
 }
 
-// UnsubscribeTopic usubscribes and stops reading values from that topic
-func UnsubscribeTopic(topic string) (err error) {
-	if connectedServer == nil {
-		return errors.New("No server connected")
-	}
-	ch := make(chan error)
-	unsub := &UnsubscribeObject{Object: js.Global.Get("Object").New()}
-	unsub.Topic = topic
-	unsub.Success = func(obj *js.Object) {
-		close(ch)
-	}
-	unsub.Error = func(obj *js.Object) {
-		err = errors.New(obj.String())
-		close(ch)
-	}
-	mo().Call("unsubscribe", unsub)
-	return
+// UnsubscribeTopic usubscribes DefaultClient and stops reading values from that topic
+func UnsubscribeTopic(topic string) error {
+	return DefaultClient.UnsubscribeTopic(topic)
 }
@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Message is a MQTT message received by a Client.
+// The plugin transport does not report Qos, Retained and Duplicate, they are only set over WebSocket.
+type Message struct {
+	Topic     string
+	Payload   []byte
+	Qos       int
+	Retained  bool
+	Duplicate bool
+}
+
+// Handler responds to MQTT messages.
+type Handler interface {
+	ServeMQTT(msg *Message)
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(msg *Message)
+
+// ServeMQTT calls f(msg).
+func (f HandlerFunc) ServeMQTT(msg *Message) {
+	f(msg)
+}
+
+// ValidateFilter checks a topic filter against the MQTT 3.1.1 rules:
+// '+' must occupy a whole level and '#' must occupy the whole last level.
+func ValidateFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("%w: empty filter", ErrInvalidTopic)
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("%w: misplaced '#' in %q", ErrInvalidTopic, filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("%w: misplaced '+' in %q", ErrInvalidTopic, filter)
+		}
+	}
+	return nil
+}
+
+// ValidateTopic checks a topic name used for publishing: it must be non-empty and have no wildcards.
+func ValidateTopic(topic string) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("%w: %q", ErrInvalidTopic, topic)
+	}
+	return nil
+}
+
+// Match reports whether topic matches filter following the MQTT 3.1.1 rules.
+// Topics starting with '$' (such as $SYS) are not matched by filters starting with a wildcard.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) {
+			return false
+		}
+		if f != "+" && f != tl[i] {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+type muxEntry struct {
+	filter  string
+	handler Handler
+}
+
+// ServeMux dispatches messages to the handlers whose filter matches the message topic.
+// Every matching handler is called, in registration order.
+type ServeMux struct {
+	mu      sync.RWMutex
+	entries []muxEntry
+}
+
+// NewServeMux returns an empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers h for messages matching filter. Registering the same filter again replaces its handler.
+func (mux *ServeMux) Handle(filter string, h Handler) error {
+	if err := ValidateFilter(filter); err != nil {
+		return err
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	for i := range mux.entries {
+		if mux.entries[i].filter == filter {
+			mux.entries[i].handler = h
+			return nil
+		}
+	}
+	mux.entries = append(mux.entries, muxEntry{filter: filter, handler: h})
+	return nil
+}
+
+// HandleFunc registers fn for messages matching filter.
+func (mux *ServeMux) HandleFunc(filter string, fn func(msg *Message)) error {
+	return mux.Handle(filter, HandlerFunc(fn))
+}
+
+// Remove unregisters the handler of filter.
+func (mux *ServeMux) Remove(filter string) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	for i := range mux.entries {
+		if mux.entries[i].filter == filter {
+			mux.entries = append(mux.entries[:i], mux.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Filters returns the registered filters.
+func (mux *ServeMux) Filters() []string {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	res := make([]string, len(mux.entries))
+	for i, e := range mux.entries {
+		res[i] = e.filter
+	}
+	return res
+}
+
+// ServeMQTT dispatches msg to every handler whose filter matches msg.Topic.
+func (mux *ServeMux) ServeMQTT(msg *Message) {
+	mux.mu.RLock()
+	handlers := []Handler{}
+	for _, e := range mux.entries {
+		if Match(e.filter, msg.Topic) {
+			handlers = append(handlers, e.handler)
+		}
+	}
+	mux.mu.RUnlock()
+	for _, h := range handlers {
+		h.ServeMQTT(msg)
+	}
+}
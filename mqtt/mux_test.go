@@ -0,0 +1,150 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"+", "a", true},
+		{"+/+", "/a", true},
+		{"a/b", "a/b/", false},
+		{"#", "$SYS/broker", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker", true},
+		{"$SYS/+", "$SYS/broker", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+	}{
+		{"a/b", true},
+		{"+", true},
+		{"#", true},
+		{"a/+/b", true},
+		{"a/#", true},
+		{"$SYS/#", true},
+		{"", false},
+		{"a/#/b", false},
+		{"a#", false},
+		{"a/b+", false},
+		{"+a/b", false},
+	}
+	for _, tt := range tests {
+		err := ValidateFilter(tt.filter)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateFilter(%q) = %v, want valid %v", tt.filter, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidTopic) {
+			t.Errorf("ValidateFilter(%q) = %v, want ErrInvalidTopic", tt.filter, err)
+		}
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	for _, topic := range []string{"", "a/+", "a/#"} {
+		if err := ValidateTopic(topic); !errors.Is(err, ErrInvalidTopic) {
+			t.Errorf("ValidateTopic(%q) = %v, want ErrInvalidTopic", topic, err)
+		}
+	}
+	if err := ValidateTopic("a/b"); err != nil {
+		t.Errorf("ValidateTopic(\"a/b\") = %v", err)
+	}
+}
+
+func TestClientHandlerWithoutCallback(t *testing.T) {
+	c := NewClient(ConnectOptions{})
+	c.subs["a/+"] = &subscription{}
+	mux := NewServeMux()
+	got := make(chan string, 10)
+	mux.HandleFunc("a/#", func(msg *Message) { got <- msg.Topic })
+	c.SetHandler(mux)
+	c.route(&Message{Topic: "a/b"})
+	c.route(&Message{Topic: "b/c"})
+	select {
+	case topic := <-got:
+		if topic != "a/b" {
+			t.Fatalf("handler got %q, want a/b", topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(got) != 0 {
+		t.Fatalf("handler called for b/c")
+	}
+}
+
+func TestClientHandlerBlocking(t *testing.T) {
+	c := NewClient(ConnectOptions{})
+	release := make(chan struct{})
+	got := make(chan string, 10)
+	c.subs["a"] = &subscription{handler: func(payload string) {
+		<-release
+		got <- payload
+	}}
+	// The route calls come from JS callbacks, they must return while the handler blocks.
+	c.route(&Message{Topic: "a", Payload: []byte("1")})
+	c.route(&Message{Topic: "a", Payload: []byte("2")})
+	close(release)
+	for _, want := range []string{"1", "2"} {
+		select {
+		case payload := <-got:
+			if payload != want {
+				t.Fatalf("handler got %q, want %q", payload, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler not called for %q", want)
+		}
+	}
+}
+
+func TestCaptureTopic(t *testing.T) {
+	tests := []struct {
+		filter   string
+		captures map[string]interface{}
+		want     string
+	}{
+		{"a/b", nil, "a/b"},
+		{"a/+/c", map[string]interface{}{"w1": "b"}, "a/b/c"},
+		{"a/+/+", map[string]interface{}{"w1": "b", "w2": "c"}, "a/b/c"},
+		{"a/#", map[string]interface{}{"w1": []interface{}{"b", "c"}}, "a/b/c"},
+		{"a/#", map[string]interface{}{"w1": []interface{}{}}, "a"},
+		{"+/#", map[string]interface{}{"w0": "a", "w1": []interface{}{"b"}}, "a/b"},
+		{"a/+", map[string]interface{}{}, "a/+"},
+		{"a/+", map[string]interface{}{"w1": 3.0}, "a/+"},
+	}
+	for _, tt := range tests {
+		got := captureTopic(tt.filter, func(name string) (interface{}, bool) {
+			v, ok := tt.captures[name]
+			return v, ok
+		})
+		if got != tt.want {
+			t.Errorf("captureTopic(%q, %v) = %q, want %q", tt.filter, tt.captures, got, tt.want)
+		}
+	}
+	if got := captureFilter("a/+/b/#"); got != "a/+w1/b/#w3" {
+		t.Errorf("captureFilter = %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jaracil/goco/nativestorage"
+)
+
+// ErrOutboxFull is returned when publishing while offline and the outbox is full.
+var ErrOutboxFull = errors.New("Outbox full")
+
+// DefaultOutboxSize is the outbox capacity used when NewOutbox is given a max of zero or less.
+const DefaultOutboxSize = 1000
+
+// Outbox is a bounded FIFO queue of QoS 1 and 2 messages published while the client is offline.
+// The client drains it in order once connected. Set it with Client.SetOutbox.
+type Outbox struct {
+	// OnResult, if set, is called with the delivery result of every queued message.
+	OnResult func(msg *Message, err error)
+
+	max int
+	key string
+
+	mu    sync.Mutex
+	queue []*Message
+
+	saveMu  sync.Mutex // serializes saves
+	drainMu sync.Mutex // serializes drains
+}
+
+// NewOutbox returns an outbox holding up to max messages (DefaultOutboxSize if max <= 0).
+// If key is not empty the queue is persisted in nativestorage under key, and messages queued by
+// a previous run are loaded.
+func NewOutbox(max int, key string) (*Outbox, error) {
+	if max <= 0 {
+		max = DefaultOutboxSize
+	}
+	o := &Outbox{max: max, key: key}
+	if key != "" {
+		queue, err := nativestorage.Get[[]*Message](key)
+		if err != nil && !errors.Is(err, nativestorage.ErrNotFound) {
+			return nil, err
+		}
+		o.queue = queue
+	}
+	return o, nil
+}
+
+// Len returns the number of queued messages.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queue)
+}
+
+// save persists the queue. It must be called without o.mu, as the store may block.
+// The queue is copied once saveMu is held, so a save never overwrites a newer one.
+func (o *Outbox) save() error {
+	if o.key == "" {
+		return nil
+	}
+	o.saveMu.Lock()
+	defer o.saveMu.Unlock()
+	o.mu.Lock()
+	queue := append([]*Message(nil), o.queue...)
+	o.mu.Unlock()
+	return nativestorage.Put(o.key, queue)
+}
+
+func (o *Outbox) push(msg *Message) error {
+	o.mu.Lock()
+	if len(o.queue) >= o.max {
+		o.mu.Unlock()
+		return ErrOutboxFull
+	}
+	o.queue = append(o.queue, msg)
+	o.mu.Unlock()
+	if err := o.save(); err != nil {
+		o.mu.Lock()
+		for i, m := range o.queue {
+			if m == msg {
+				o.queue = append(o.queue[:i:i], o.queue[i+1:]...)
+				break
+			}
+		}
+		o.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (o *Outbox) peek() *Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.queue) == 0 {
+		return nil
+	}
+	return o.queue[0]
+}
+
+func (o *Outbox) pop() {
+	o.mu.Lock()
+	if len(o.queue) == 0 {
+		o.mu.Unlock()
+		return
+	}
+	o.queue = o.queue[1:]
+	o.mu.Unlock()
+	o.save()
+}
+
+// drain publishes the queued messages in order through publish while connected returns true.
+// A message failing while still connected is reported and dropped, so it does not block the queue.
+func (o *Outbox) drain(publish func(msg *Message) error, connected func() bool) {
+	o.drainMu.Lock()
+	defer o.drainMu.Unlock()
+	for connected() {
+		msg := o.peek()
+		if msg == nil {
+			return
+		}
+		err := publish(msg)
+		if err != nil && !connected() {
+			return
+		}
+		o.pop()
+		if o.OnResult != nil {
+			o.OnResult(msg, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jaracil/goco/nativestorage"
+)
+
+func TestOutboxDefaultSize(t *testing.T) {
+	o, err := NewOutbox(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < DefaultOutboxSize; i++ {
+		if err := o.push(&Message{Topic: "t"}); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+	if err := o.push(&Message{Topic: "t"}); !errors.Is(err, ErrOutboxFull) {
+		t.Fatalf("push beyond DefaultOutboxSize = %v, want ErrOutboxFull", err)
+	}
+}
+
+func TestOutboxPersisted(t *testing.T) {
+	nativestorage.SetDefaultStore(nativestorage.NewMemoryStore())
+	t.Cleanup(func() { nativestorage.SetDefaultStore(nil) })
+	o, err := NewOutbox(2, "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.push(&Message{Topic: "a", Payload: []byte("1"), Qos: 1})
+	o.push(&Message{Topic: "b", Payload: []byte("2"), Qos: 2})
+	if err := o.push(&Message{Topic: "c"}); !errors.Is(err, ErrOutboxFull) {
+		t.Fatalf("push = %v, want ErrOutboxFull", err)
+	}
+	o.pop()
+	loaded, err := NewOutbox(2, "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 1 {
+		t.Fatalf("loaded %d messages, want 1", loaded.Len())
+	}
+	if msg := loaded.peek(); msg.Topic != "b" || string(msg.Payload) != "2" || msg.Qos != 2 {
+		t.Fatalf("loaded %+v", msg)
+	}
+}
@@ -0,0 +1,243 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetPubrec      = 5
+	packetPubrel      = 6
+	packetPubcomp     = 7
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// connackReasons are the CONNACK return codes.
+var connackReasons = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// packet is a decoded control packet.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// encodePacket prepends the fixed header to body.
+func encodePacket(typ, flags byte, body []byte) []byte {
+	buf := []byte{typ<<4 | flags&0x0f}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(buf, body...)
+}
+
+// decodePacket reads a packet from the start of buf. It returns the number of bytes consumed,
+// which is zero when buf does not hold a whole packet yet.
+func decodePacket(buf []byte) (*packet, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, nil
+	}
+	size, mul, i := 0, 1, 1
+	for {
+		if i >= len(buf) {
+			return nil, 0, nil
+		}
+		if i > 4 {
+			return nil, 0, fmt.Errorf("%w: malformed remaining length", ErrProtocol)
+		}
+		b := buf[i]
+		size += int(b&0x7f) * mul
+		mul *= 128
+		i++
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if len(buf) < i+size {
+		return nil, 0, nil
+	}
+	p := &packet{typ: buf[0] >> 4, flags: buf[0] & 0x0f, body: buf[i : i+size]}
+	return p, i + size, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	return appendBytes(buf, []byte(s))
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(b)))
+	return append(buf, b...)
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, fmt.Errorf("%w: short string", ErrProtocol)
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", nil, fmt.Errorf("%w: short string", ErrProtocol)
+	}
+	return string(buf[2 : 2+n]), buf[2+n:], nil
+}
+
+// connectPacket builds the CONNECT packet for opts.
+func connectPacket(opts *ConnectOptions, keepAlive time.Duration) []byte {
+	var flags byte
+	if !opts.PersistentSession {
+		flags |= 0x02
+	}
+	if w := opts.Will; w != nil {
+		flags |= 0x04 | byte(w.Qos)<<3
+		if w.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if w := opts.Will; w != nil {
+		body = appendString(body, w.Topic)
+		body = appendString(body, w.Payload)
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return encodePacket(packetConnect, 0, body)
+}
+
+// connackError returns the error matching the CONNACK return code, nil when accepted.
+func connackError(p *packet) error {
+	if len(p.body) != 2 {
+		return fmt.Errorf("%w: malformed CONNACK", ErrProtocol)
+	}
+	code := p.body[1]
+	if code == 0 {
+		return nil
+	}
+	reason, ok := connackReasons[code]
+	if !ok {
+		reason = fmt.Sprintf("return code %d", code)
+	}
+	return fmt.Errorf("%w: %s", ErrRefused, reason)
+}
+
+// publishPacket builds the PUBLISH packet of msg. id is ignored for QoS 0.
+func publishPacket(msg *Message, id uint16) []byte {
+	flags := byte(msg.Qos) << 1
+	if msg.Retained {
+		flags |= 0x01
+	}
+	if msg.Duplicate {
+		flags |= 0x08
+	}
+	body := appendString(nil, msg.Topic)
+	if msg.Qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, msg.Payload...)
+	return encodePacket(packetPublish, flags, body)
+}
+
+// parsePublish decodes a PUBLISH packet. id is zero for QoS 0.
+func parsePublish(p *packet) (msg *Message, id uint16, err error) {
+	msg = &Message{
+		Qos:       int(p.flags>>1) & 0x03,
+		Retained:  p.flags&0x01 != 0,
+		Duplicate: p.flags&0x08 != 0,
+	}
+	if msg.Qos > 2 {
+		return nil, 0, fmt.Errorf("%w: invalid QoS", ErrProtocol)
+	}
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return nil, 0, err
+	}
+	msg.Topic = topic
+	if msg.Qos > 0 {
+		if len(rest) < 2 {
+			return nil, 0, fmt.Errorf("%w: missing packet identifier", ErrProtocol)
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	msg.Payload = append([]byte(nil), rest...)
+	return msg, id, nil
+}
+
+// ackPacket builds a PUBACK, PUBREC, PUBREL, PUBCOMP or UNSUBACK style packet.
+func ackPacket(typ byte, id uint16) []byte {
+	var flags byte
+	if typ == packetPubrel {
+		flags = 0x02
+	}
+	return encodePacket(typ, flags, binary.BigEndian.AppendUint16(nil, id))
+}
+
+// packetID returns the packet identifier starting the variable header.
+func packetID(p *packet) (uint16, error) {
+	if len(p.body) < 2 {
+		return 0, fmt.Errorf("%w: missing packet identifier", ErrProtocol)
+	}
+	return binary.BigEndian.Uint16(p.body), nil
+}
+
+func subscribePacket(id uint16, filter string, qos int) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, byte(qos))
+	return encodePacket(packetSubscribe, 0x02, body)
+}
+
+// subackError returns an error when the server refused the subscription.
+func subackError(p *packet) error {
+	if len(p.body) < 3 {
+		return fmt.Errorf("%w: malformed SUBACK", ErrProtocol)
+	}
+	if p.body[2] == 0x80 {
+		return fmt.Errorf("%w: subscription", ErrRefused)
+	}
+	return nil
+}
+
+func unsubscribePacket(id uint16, filter string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	return encodePacket(packetUnsubscribe, 0x02, body)
+}
@@ -0,0 +1,121 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRemainingLength(t *testing.T) {
+	tests := []struct {
+		size   int
+		header []byte
+	}{
+		{0, []byte{0x30, 0x00}},
+		{127, []byte{0x30, 0x7f}},
+		{128, []byte{0x30, 0x80, 0x01}},
+		{16383, []byte{0x30, 0xff, 0x7f}},
+		{16384, []byte{0x30, 0x80, 0x80, 0x01}},
+		{2097151, []byte{0x30, 0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x30, 0x80, 0x80, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		buf := encodePacket(packetPublish, 0, make([]byte, tt.size))
+		if !bytes.Equal(buf[:len(tt.header)], tt.header) {
+			t.Errorf("size %d: header % x, want % x", tt.size, buf[:len(tt.header)], tt.header)
+			continue
+		}
+		p, n, err := decodePacket(buf)
+		if err != nil || n != len(buf) || p.typ != packetPublish || len(p.body) != tt.size {
+			t.Errorf("size %d: decode = %v, %d, %v", tt.size, p, n, err)
+		}
+		if _, n, err := decodePacket(buf[:len(buf)-1]); tt.size > 0 && (n != 0 || err != nil) {
+			t.Errorf("size %d: incomplete decode = %d, %v", tt.size, n, err)
+		}
+	}
+}
+
+func TestRemainingLengthMalformed(t *testing.T) {
+	_, _, err := decodePacket([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if !errors.Is(err, ErrProtocol) {
+		t.Fatalf("err = %v, want ErrProtocol", err)
+	}
+}
+
+func TestConnectFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  ConnectOptions
+		flags byte
+	}{
+		{"clean", ConnectOptions{ClientID: "c"}, 0x02},
+		{"persistent", ConnectOptions{ClientID: "c", PersistentSession: true}, 0x00},
+		{"user", ConnectOptions{ClientID: "c", Username: "u"}, 0x82},
+		{"user password", ConnectOptions{ClientID: "c", Username: "u", Password: "p"}, 0xc2},
+		{"will qos 1", ConnectOptions{ClientID: "c", Will: &Will{Topic: "w", Qos: 1}}, 0x0e},
+		{"will qos 2 retain", ConnectOptions{ClientID: "c", Will: &Will{Topic: "w", Qos: 2, Retain: true}}, 0x36},
+	}
+	for _, tt := range tests {
+		p, _, err := decodePacket(connectPacket(&tt.opts, 30*time.Second))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body := p.body
+		if p.typ != packetConnect || !bytes.Equal(body[:7], []byte{0, 4, 'M', 'Q', 'T', 'T', 4}) {
+			t.Errorf("%s: bad protocol header % x", tt.name, body[:7])
+		}
+		if body[7] != tt.flags {
+			t.Errorf("%s: flags %#02x, want %#02x", tt.name, body[7], tt.flags)
+		}
+		if body[8] != 0 || body[9] != 30 {
+			t.Errorf("%s: keepalive % x, want 00 1e", tt.name, body[8:10])
+		}
+		id, _, err := readString(body[10:])
+		if err != nil || id != "c" {
+			t.Errorf("%s: client ID %q, %v", tt.name, id, err)
+		}
+	}
+}
+
+func TestPublishPacket(t *testing.T) {
+	tests := []struct {
+		msg Message
+		id  uint16
+	}{
+		{Message{Topic: "a/b", Payload: []byte("x")}, 0},
+		{Message{Topic: "a/b", Payload: []byte{0, 1, 2}, Qos: 1, Retained: true}, 7},
+		{Message{Topic: "a", Payload: []byte{}, Qos: 2, Duplicate: true}, 65535},
+	}
+	for _, tt := range tests {
+		p, _, err := decodePacket(publishPacket(&tt.msg, tt.id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, id, err := parsePublish(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != tt.id || msg.Topic != tt.msg.Topic || !bytes.Equal(msg.Payload, tt.msg.Payload) ||
+			msg.Qos != tt.msg.Qos || msg.Retained != tt.msg.Retained || msg.Duplicate != tt.msg.Duplicate {
+			t.Errorf("round trip of %+v (id %d) = %+v (id %d)", tt.msg, tt.id, msg, id)
+		}
+	}
+}
+
+func TestConnackError(t *testing.T) {
+	tests := []struct {
+		code byte
+		want error
+	}{
+		{0, nil},
+		{4, ErrRefused},
+		{5, ErrRefused},
+	}
+	for _, tt := range tests {
+		err := connackError(&packet{typ: packetConnack, body: []byte{0, tt.code}})
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("code %d: err = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+}
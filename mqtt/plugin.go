@@ -0,0 +1,279 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// The plugin handles a single native connection, so it is owned by one transport (of one Client) at a time.
+var (
+	instance    *js.Object
+	pluginMu    sync.Mutex
+	pluginOwner *pluginTransport
+	listening   = map[string]bool{}
+)
+
+// mo returns the plugin object, or nil when cordova or the plugin is not available.
+func mo() *js.Object {
+	if instance == nil {
+		cordova := js.Global.Get("cordova")
+		if cordova == nil || cordova == js.Undefined {
+			return nil
+		}
+		plugins := cordova.Get("plugins")
+		if plugins == nil || plugins == js.Undefined {
+			return nil
+		}
+		if ob := plugins.Get("CordovaMqTTPlugin"); ob != nil && ob != js.Undefined {
+			instance = ob
+		}
+	}
+	return instance
+}
+
+func pluginAvailable() bool {
+	return mo() != nil
+}
+
+func acquirePlugin(t *pluginTransport) error {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	if pluginOwner != nil && pluginOwner != t {
+		return ErrPluginBusy
+	}
+	pluginOwner = t
+	return nil
+}
+
+func releasePlugin(t *pluginTransport) {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	if pluginOwner == t {
+		pluginOwner = nil
+	}
+}
+
+func ownsPlugin(t *pluginTransport) bool {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	return pluginOwner == t
+}
+
+// owner returns the client owning the plugin, or nil.
+func owner() *Client {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	if pluginOwner == nil {
+		return nil
+	}
+	return pluginOwner.c
+}
+
+func pluginConnect(opts *ConnectOptions, onLost func()) (err error) {
+	if !pluginAvailable() {
+		return ErrPluginNotFound
+	}
+	server := &Server{Object: js.Global.Get("Object").New()}
+	server.URL = opts.brokerURL()
+	server.Port = opts.Port
+	server.ClientID = opts.ClientID
+	server.CleanSession = !opts.PersistentSession
+	server.OnConnectionLost = onLost
+	server.IsBinaryPayload = opts.BinaryPayload
+	if opts.Username != "" {
+		server.Username = opts.Username
+		server.Password = opts.Password
+	}
+	if opts.KeepAlive > 0 {
+		server.KeepAlive = int(opts.KeepAlive / time.Second)
+	}
+	if opts.ConnectionTimeout > 0 {
+		server.ConnectionTimeout = int(opts.ConnectionTimeout / time.Millisecond)
+	}
+	if w := opts.Will; w != nil {
+		will := &WillTopicConfig{Object: js.Global.Get("Object").New()}
+		will.Topic = w.Topic
+		will.Payload = w.Payload
+		will.Qos = w.Qos
+		will.Retain = w.Retain
+		server.WillTopicConfig = will
+	}
+	ch := make(chan struct{})
+	server.Success = func(obj *js.Object) {
+		close(ch)
+	}
+	server.Error = func(obj *js.Object) {
+		err = errors.New(obj.String())
+		close(ch)
+	}
+	mo().Call("connect", server)
+	<-ch
+	return
+}
+
+func pluginDisconnect() (err error) {
+	ch := make(chan struct{})
+	disc := &DisconnectObject{Object: js.Global.Get("Object").New()}
+	disc.Success = func(obj *js.Object) {
+		close(ch)
+	}
+	disc.Error = func(obj *js.Object) {
+		err = errors.New(obj.String())
+		close(ch)
+	}
+	mo().Call("disconnect", disc)
+	<-ch
+	return
+}
+
+func pluginSubscribe(topic string, qos int) (err error) {
+	ch := make(chan struct{})
+	subs := &SusbscribeObject{Object: js.Global.Get("Object").New()}
+	subs.Topic = topic
+	subs.Qos = qos
+	subs.Success = func(obj *js.Object) {
+		close(ch)
+	}
+	subs.Error = func(obj *js.Object) {
+		err = errors.New(obj.String())
+		close(ch)
+	}
+	mo().Call("subscribe", subs)
+	<-ch
+	if err == nil {
+		pluginListen(topic)
+	}
+	return
+}
+
+// pluginListen registers (once per filter) the plugin listener routing messages to the current owner.
+// The plugin has no way to remove listeners, so clients drop messages of filters they are not subscribed to.
+func pluginListen(filter string) {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	if listening[filter] {
+		return
+	}
+	listening[filter] = true
+	mo().Call("listen", captureFilter(filter), func(payload string, params *js.Object) {
+		if c := owner(); c != nil {
+			c.dispatch(filter, pluginMessage(filter, payload, params, c.opts.BinaryPayload))
+		}
+	})
+}
+
+// captureFilter returns filter with its wildcards named after their level ("+w1", "#w2"),
+// so the plugin listen callback reports the levels they matched in params.
+func captureFilter(filter string) string {
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if l == "+" || l == "#" {
+			levels[i] = l + "w" + strconv.Itoa(i)
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// captureTopic rebuilds the topic matched by filter from the wildcard captures (a string for "+",
+// the list of levels for "#"), as reported for captureFilter(filter).
+// It returns filter when a capture is missing.
+func captureTopic(filter string, capture func(name string) (interface{}, bool)) string {
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if l != "+" && l != "#" {
+			continue
+		}
+		v, ok := capture("w" + strconv.Itoa(i))
+		if !ok {
+			return filter
+		}
+		switch v := v.(type) {
+		case string:
+			levels[i] = v
+		case []interface{}:
+			parts := make([]string, len(v))
+			for j, p := range v {
+				s, ok := p.(string)
+				if !ok {
+					return filter
+				}
+				parts[j] = s
+			}
+			if len(parts) == 0 {
+				// "a/#" matched "a" itself.
+				return strings.Join(levels[:i], "/")
+			}
+			levels[i] = strings.Join(parts, "/")
+		default:
+			return filter
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// pluginMessage builds a Message from a plugin listen callback. The plugin only reports the payload
+// and the wildcard captures, from which Topic is rebuilt; Qos, Retained and Duplicate are not reported
+// and stay zero. Binary payloads arrive base64 encoded.
+func pluginMessage(filter string, payload string, params *js.Object, binary bool) *Message {
+	msg := &Message{Topic: filter, Payload: []byte(payload)}
+	if binary {
+		if data, err := base64.StdEncoding.DecodeString(payload); err == nil {
+			msg.Payload = data
+		}
+	}
+	if params != nil && params != js.Undefined {
+		msg.Topic = captureTopic(filter, func(name string) (interface{}, bool) {
+			v := params.Get(name)
+			if v == nil || v == js.Undefined {
+				return nil, false
+			}
+			return v.Interface(), true
+		})
+	}
+	return msg
+}
+
+func pluginUnsubscribe(topic string) (err error) {
+	ch := make(chan struct{})
+	unsub := &UnsubscribeObject{Object: js.Global.Get("Object").New()}
+	unsub.Topic = topic
+	unsub.Success = func(obj *js.Object) {
+		close(ch)
+	}
+	unsub.Error = func(obj *js.Object) {
+		err = errors.New(obj.String())
+		close(ch)
+	}
+	mo().Call("unsubscribe", unsub)
+	<-ch
+	return
+}
+
+func pluginPublish(topic string, payload []byte, qos int, retain bool, binary bool) (err error) {
+	ch := make(chan struct{})
+	pub := &PublishOBject{Object: js.Global.Get("Object").New()}
+	pub.Topic = topic
+	if binary {
+		pub.Payload = base64.StdEncoding.EncodeToString(payload)
+	} else {
+		pub.Payload = string(payload)
+	}
+	pub.Qos = qos
+	pub.Retain = retain
+	pub.Success = func(obj *js.Object) {
+		close(ch)
+	}
+	pub.Error = func(obj *js.Object) {
+		err = errors.New(obj.String())
+		close(ch)
+	}
+	mo().Call("publish", pub)
+	<-ch
+	return
+}
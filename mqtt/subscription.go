@@ -0,0 +1,244 @@
+package mqtt
+
+import (
+	"sync"
+)
+
+// Policy tells a Subscription what to do with a message arriving while its buffer is full.
+type Policy int
+
+const (
+	// DropNewest discards the arriving message.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest buffered message to make room for the arriving one.
+	DropOldest
+	// Queue holds up to Buffer (at least 1) more messages in a queue while the buffer is full, forwarding
+	// them in order as the reader catches up; when the queue is full too, arriving messages are dropped.
+	// It does not slow down the broker: the transports acknowledge messages as they arrive.
+	Queue
+)
+
+// SubscribeOptions configures the channel of a Subscription.
+type SubscribeOptions struct {
+	Buffer int    // Capacity of the Messages channel
+	Policy Policy // What to do when the buffer is full
+}
+
+// DefaultSubscribeOptions are the options used by Subscribe.
+var DefaultSubscribeOptions = SubscribeOptions{Buffer: 64, Policy: DropNewest}
+
+// Subscription delivers the messages of a topic filter through a channel, so slow readers
+// do not stall the plugin events.
+type Subscription struct {
+	client *Client
+	filter string
+	qos    int
+	policy Policy
+	ch     chan Message
+
+	mu      sync.Mutex // guards the fields below
+	closed  bool
+	dropped int
+	pending []Message     // messages waiting for the pump (Queue policy), at most Buffer (or 1)
+	sending bool          // the pump holds a message taken from pending
+	wake    chan struct{} // signals the pump
+	done    chan struct{} // closed when the subscription ends
+}
+
+// Subscribe subscribes to a topic filter with DefaultSubscribeOptions.
+func (c *Client) Subscribe(topic string, qos int) (*Subscription, error) {
+	return c.SubscribeWithOptions(topic, qos, DefaultSubscribeOptions)
+}
+
+// SubscribeWithOptions subscribes to a topic filter delivering its messages through Subscription.Messages.
+// The subscription is restored after reconnecting and ends on Unsubscribe, UnsubscribeTopic or Disconnect.
+func (c *Client) SubscribeWithOptions(topic string, qos int, opts SubscribeOptions) (*Subscription, error) {
+	if err := ValidateFilter(topic); err != nil {
+		return nil, err
+	}
+	if opts.Buffer < 0 {
+		opts.Buffer = 0
+	}
+	if !c.Connected() {
+		return nil, ErrNotConnected
+	}
+	s := &Subscription{
+		client: c,
+		filter: topic,
+		qos:    qos,
+		policy: opts.Policy,
+		ch:     make(chan Message, opts.Buffer),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	tr, err := c.transport()
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.subscribe(topic, qos); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	sub := c.subs[topic]
+	if sub == nil {
+		sub = &subscription{}
+		c.subs[topic] = sub
+	}
+	sub.qos = qos
+	sub.chans = append(sub.chans, s)
+	c.mu.Unlock()
+	if s.policy == Queue {
+		go s.pump()
+	}
+	return s, nil
+}
+
+// Topic returns the subscribed topic filter.
+func (s *Subscription) Topic() string {
+	return s.filter
+}
+
+// Messages returns the channel receiving the messages. It is closed when the subscription ends.
+func (s *Subscription) Messages() <-chan Message {
+	return s.ch
+}
+
+// Dropped returns the number of messages discarded because the buffer (and the queue of the Queue policy) was full.
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Unsubscribe ends the subscription and closes its channel. The server subscription is removed
+// once no other subscription or SubscribeTopic callback uses the filter.
+func (s *Subscription) Unsubscribe() error {
+	c := s.client
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.mu.Lock()
+	last := false
+	if sub := c.subs[s.filter]; sub != nil {
+		for i, o := range sub.chans {
+			if o == s {
+				sub.chans = append(sub.chans[:i], sub.chans[i+1:]...)
+				break
+			}
+		}
+		if len(sub.chans) == 0 && sub.handler == nil {
+			delete(c.subs, s.filter)
+			last = true
+		}
+	}
+	connected := c.state == StateConnected
+	tr := c.tr
+	c.mu.Unlock()
+	s.close()
+	if last && connected && tr != nil {
+		return tr.unsubscribe(s.filter)
+	}
+	return nil
+}
+
+// deliver queues msg following the subscription policy. It never blocks.
+func (s *Subscription) deliver(msg *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case Queue:
+		limit := cap(s.ch)
+		if limit < 1 {
+			limit = 1
+		}
+		if len(s.pending) == 0 && !s.sending {
+			// Nothing waiting to keep in order, fill the channel buffer first.
+			select {
+			case s.ch <- *msg:
+				return
+			default:
+			}
+		}
+		if len(s.pending) >= limit {
+			s.dropped++
+			return
+		}
+		s.pending = append(s.pending, *msg)
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- *msg:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.dropped++
+			default:
+				// Unbuffered channel without a waiting reader.
+				s.dropped++
+				return
+			}
+		}
+	default:
+		select {
+		case s.ch <- *msg:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// pump forwards the pending messages to the channel, waiting for the reader (Queue policy).
+func (s *Subscription) pump() {
+	defer close(s.ch)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		for {
+			s.mu.Lock()
+			if len(s.pending) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			msg := s.pending[0]
+			s.pending = s.pending[1:]
+			s.sending = true
+			s.mu.Unlock()
+			select {
+			case s.ch <- msg:
+			case <-s.done:
+				return
+			}
+			s.mu.Lock()
+			s.sending = false
+			s.mu.Unlock()
+		}
+	}
+}
+
+// close ends the subscription. The pump closes the channel itself under the Queue policy.
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.pending = nil
+	close(s.done)
+	if s.policy != Queue {
+		close(s.ch)
+	}
+}
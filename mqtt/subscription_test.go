@@ -0,0 +1,78 @@
+package mqtt
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestSubscription(buffer int, policy Policy) *Subscription {
+	s := &Subscription{
+		policy: policy,
+		ch:     make(chan Message, buffer),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if policy == Queue {
+		go s.pump()
+	}
+	return s
+}
+
+// drain reads the payloads available within a short delay.
+func drain(s *Subscription) []string {
+	got := []string{}
+	for {
+		select {
+		case msg := <-s.ch:
+			got = append(got, string(msg.Payload))
+		case <-time.After(20 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+func TestSubscriptionPolicies(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   []string
+	}{
+		{DropNewest, []string{"0", "1"}},
+		{DropOldest, []string{"8", "9"}},
+	}
+	for _, tt := range tests {
+		s := newTestSubscription(2, tt.policy)
+		for i := 0; i < 10; i++ {
+			s.deliver(&Message{Payload: []byte(strconv.Itoa(i))})
+		}
+		got := drain(s)
+		if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, got, tt.want)
+		}
+		if s.Dropped() != 8 {
+			t.Errorf("policy %d: dropped %d, want 8", tt.policy, s.Dropped())
+		}
+		s.close()
+	}
+}
+
+func TestSubscriptionQueue(t *testing.T) {
+	s := newTestSubscription(2, Queue)
+	for i := 0; i < 10; i++ {
+		s.deliver(&Message{Payload: []byte(strconv.Itoa(i))})
+	}
+	got := drain(s)
+	// The buffer and the queue hold 2 messages each, in order.
+	if len(got) != 4 || s.Dropped() != 6 {
+		t.Fatalf("got %v with %d dropped", got, s.Dropped())
+	}
+	for i, p := range got {
+		if p != strconv.Itoa(i) {
+			t.Fatalf("got %v, want the first messages in order", got)
+		}
+	}
+	s.close()
+	if _, ok := <-s.ch; ok {
+		t.Fatal("channel not closed")
+	}
+}
@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// transport carries the MQTT connection of a Client. Received messages are handed to the client
+// with dispatch (by subscription filter) or route (by topic).
+type transport interface {
+	// connect opens the connection; onLost is called (without blocking) when it drops unexpectedly.
+	connect(opts *ConnectOptions, onLost func()) error
+	disconnect() error
+	// release frees the transport once the client is disconnected.
+	release()
+	subscribe(filter string, qos int) error
+	unsubscribe(filter string) error
+	publish(msg *Message) error
+}
+
+// newTransport selects the transport of c: the plugin when installed, otherwise
+// MQTT over the browser WebSocket API (e.g. Cordova browser platform).
+func newTransport(c *Client) (transport, error) {
+	if native.available() {
+		return &pluginTransport{c: c}, nil
+	}
+	if ws := js.Global.Get("WebSocket"); ws != nil && ws != js.Undefined {
+		return &wsTransport{c: c}, nil
+	}
+	return nil, ErrPluginNotFound
+}
+
+// pluginAPI is the native plugin under the pluginTransport.
+type pluginAPI interface {
+	available() bool
+	connect(opts *ConnectOptions, onLost func()) error
+	disconnect() error
+	subscribe(filter string, qos int) error
+	unsubscribe(filter string) error
+	publish(msg *Message, binary bool) error
+}
+
+// jsPlugin is the pluginAPI over 'CordovaMqTTPlugin'.
+type jsPlugin struct{}
+
+func (jsPlugin) available() bool { return pluginAvailable() }
+
+func (jsPlugin) connect(opts *ConnectOptions, onLost func()) error {
+	return pluginConnect(opts, onLost)
+}
+
+func (jsPlugin) disconnect() error { return pluginDisconnect() }
+
+func (jsPlugin) subscribe(filter string, qos int) error { return pluginSubscribe(filter, qos) }
+
+func (jsPlugin) unsubscribe(filter string) error { return pluginUnsubscribe(filter) }
+
+func (jsPlugin) publish(msg *Message, binary bool) error {
+	return pluginPublish(msg.Topic, msg.Payload, msg.Qos, msg.Retained, binary)
+}
+
+var native pluginAPI = jsPlugin{}
+
+// pluginTransport is the transport backed by 'CordovaMqTTPlugin'.
+// Every connection attempt uses its own pluginTransport, which owns the plugin until released,
+// so a stale attempt can't tear down the connection of a newer one.
+type pluginTransport struct {
+	c *Client
+}
+
+func (t *pluginTransport) connect(opts *ConnectOptions, onLost func()) error {
+	if err := acquirePlugin(t); err != nil {
+		return err
+	}
+	return native.connect(opts, onLost)
+}
+
+func (t *pluginTransport) disconnect() error {
+	if !ownsPlugin(t) {
+		// Released, the plugin connection (if any) belongs to a newer transport.
+		return nil
+	}
+	return native.disconnect()
+}
+
+func (t *pluginTransport) release() {
+	releasePlugin(t)
+}
+
+func (t *pluginTransport) subscribe(filter string, qos int) error {
+	return native.subscribe(filter, qos)
+}
+
+func (t *pluginTransport) unsubscribe(filter string) error {
+	return native.unsubscribe(filter)
+}
+
+func (t *pluginTransport) publish(msg *Message) error {
+	return native.publish(msg, t.c.opts.BinaryPayload)
+}
@@ -0,0 +1,472 @@
+package mqtt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+const (
+	defaultKeepAlive         = 60 * time.Second
+	defaultConnectionTimeout = 30 * time.Second
+)
+
+// wsTransport speaks MQTT 3.1.1 over the browser WebSocket API.
+// Each connect opens a new wsConn; the transport keeps the current one.
+type wsTransport struct {
+	c *Client
+
+	mu   sync.Mutex
+	conn *wsConn
+}
+
+// socket is the byte stream under a wsConn. Received data is passed to wsConn.receive,
+// and wsConn.closed is called once the socket is closed.
+type socket interface {
+	send(data []byte) error
+	close()
+}
+
+// jsSocket is a socket over a browser WebSocket.
+type jsSocket struct {
+	ws *js.Object
+}
+
+func (s *jsSocket) send(data []byte) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrConnectionLost
+		}
+	}()
+	if s.ws.Get("readyState").Int() != 1 {
+		return ErrConnectionLost
+	}
+	s.ws.Call("send", js.NewArrayBuffer(data))
+	return nil
+}
+
+func (s *jsSocket) close() {
+	s.ws.Call("close")
+}
+
+// wsConn is a single connection to the broker.
+type wsConn struct {
+	c         *Client
+	sock      socket
+	timeout   time.Duration
+	keepAlive time.Duration
+	onLost    func()
+
+	mu       sync.Mutex // guards the fields below
+	buf      []byte     // received bytes not yet decoded
+	nextID   uint16
+	acks     map[uint16]chan *packet // waiters by packet identifier
+	received map[uint16]bool         // QoS 2 messages waiting for PUBREL
+	lastSent time.Time
+	pingSent time.Time // PINGREQ waiting for PINGRESP, zero if none
+	up       bool      // CONNACK accepted
+	closing  bool      // closed by us, do not report the loss
+	err      error
+
+	connack chan *packet
+	done    chan struct{} // closed when the socket closes
+}
+
+// wsURL returns the WebSocket URL of the broker: tcp and ssl schemes map to ws and wss,
+// and the path defaults to "/mqtt".
+func wsURL(opts *ConnectOptions) string {
+	scheme, rest := "ws", opts.URL
+	if opts.TLS {
+		scheme = "wss"
+	}
+	if i := strings.Index(rest, "://"); i >= 0 {
+		switch rest[:i] {
+		case "ssl", "wss":
+			scheme = "wss"
+		default:
+			scheme = "ws"
+		}
+		rest = rest[i+3:]
+	}
+	host, path := rest, "/mqtt"
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+	return scheme + "://" + host + ":" + strconv.Itoa(opts.Port) + path
+}
+
+func (t *wsTransport) current() (*wsConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return t.conn, nil
+}
+
+func newWSConn(c *Client, opts *ConnectOptions, onLost func()) *wsConn {
+	wc := &wsConn{
+		c:         c,
+		timeout:   opts.ConnectionTimeout,
+		keepAlive: opts.KeepAlive,
+		onLost:    onLost,
+		acks:      map[uint16]chan *packet{},
+		received:  map[uint16]bool{},
+		lastSent:  time.Now(),
+		connack:   make(chan *packet, 1),
+		done:      make(chan struct{}),
+	}
+	if wc.timeout <= 0 {
+		wc.timeout = defaultConnectionTimeout
+	}
+	if wc.keepAlive <= 0 {
+		wc.keepAlive = defaultKeepAlive
+	}
+	return wc
+}
+
+func (t *wsTransport) connect(opts *ConnectOptions, onLost func()) error {
+	wc := newWSConn(t.c, opts, onLost)
+	if err := wc.dial(wsURL(opts)); err != nil {
+		return err
+	}
+	if err := wc.handshake(opts); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.conn = wc
+	t.mu.Unlock()
+	go wc.ping()
+	return nil
+}
+
+func (t *wsTransport) disconnect() error {
+	wc, err := t.current()
+	if err != nil {
+		return err
+	}
+	wc.close(encodePacket(packetDisconnect, 0, nil))
+	return nil
+}
+
+func (t *wsTransport) release() {
+	t.mu.Lock()
+	wc := t.conn
+	t.conn = nil
+	t.mu.Unlock()
+	if wc != nil {
+		wc.close(nil)
+	}
+}
+
+func (t *wsTransport) subscribe(filter string, qos int) error {
+	wc, err := t.current()
+	if err != nil {
+		return err
+	}
+	id, ack := wc.register()
+	defer wc.unregister(id)
+	p, err := wc.request(ack, subscribePacket(id, filter, qos))
+	if err != nil {
+		return err
+	}
+	return subackError(p)
+}
+
+func (t *wsTransport) unsubscribe(filter string) error {
+	wc, err := t.current()
+	if err != nil {
+		return err
+	}
+	id, ack := wc.register()
+	defer wc.unregister(id)
+	_, err = wc.request(ack, unsubscribePacket(id, filter))
+	return err
+}
+
+func (t *wsTransport) publish(msg *Message) error {
+	wc, err := t.current()
+	if err != nil {
+		return err
+	}
+	if msg.Qos == 0 {
+		return wc.send(publishPacket(msg, 0))
+	}
+	id, ack := wc.register()
+	defer wc.unregister(id)
+	if _, err := wc.request(ack, publishPacket(msg, id)); err != nil {
+		return err
+	}
+	if msg.Qos == 2 {
+		// PUBREC received, release the message and wait for PUBCOMP.
+		if _, err := wc.request(ack, ackPacket(packetPubrel, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dial opens the WebSocket to url.
+func (wc *wsConn) dial(url string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			// The WebSocket constructor throws on malformed URLs.
+			err = errors.New(js.Global.Get("String").Invoke(e).String())
+		}
+	}()
+	opened := make(chan struct{})
+	ws := js.Global.Get("WebSocket").New(url, "mqtt")
+	ws.Set("binaryType", "arraybuffer")
+	ws.Set("onopen", func(ev *js.Object) {
+		close(opened)
+	})
+	ws.Set("onmessage", func(ev *js.Object) {
+		wc.receive(js.Global.Get("Uint8Array").New(ev.Get("data")).Interface().([]byte))
+	})
+	ws.Set("onclose", func(ev *js.Object) {
+		wc.closed()
+	})
+	wc.sock = &jsSocket{ws: ws}
+	timer := time.NewTimer(wc.timeout)
+	defer timer.Stop()
+	select {
+	case <-opened:
+		return nil
+	case <-wc.done:
+		return wc.closeErr()
+	case <-timer.C:
+		wc.close(nil)
+		return ErrTimeout
+	}
+}
+
+// handshake sends CONNECT and waits for the CONNACK.
+func (wc *wsConn) handshake(opts *ConnectOptions) error {
+	if err := wc.send(connectPacket(opts, wc.keepAlive)); err != nil {
+		wc.close(nil)
+		return err
+	}
+	timer := time.NewTimer(wc.timeout)
+	defer timer.Stop()
+	select {
+	case p := <-wc.connack:
+		if err := connackError(p); err != nil {
+			wc.close(nil)
+			return err
+		}
+		wc.mu.Lock()
+		wc.up = true
+		wc.mu.Unlock()
+		return nil
+	case <-wc.done:
+		return wc.closeErr()
+	case <-timer.C:
+		wc.close(nil)
+		return ErrTimeout
+	}
+}
+
+// closed is called once the socket is closed; it reports the loss unless we closed it.
+func (wc *wsConn) closed() {
+	wc.mu.Lock()
+	lost := wc.up && !wc.closing
+	wc.closing = true
+	if wc.err == nil {
+		wc.err = ErrConnectionLost
+	}
+	wc.mu.Unlock()
+	close(wc.done)
+	if lost && wc.onLost != nil {
+		wc.onLost()
+	}
+}
+
+func (wc *wsConn) closeErr() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.err
+}
+
+// close closes the socket without reporting a connection loss, sending last first if not nil.
+func (wc *wsConn) close(last []byte) {
+	wc.mu.Lock()
+	if wc.closing {
+		wc.mu.Unlock()
+		return
+	}
+	wc.closing = true
+	wc.err = ErrNotConnected
+	wc.mu.Unlock()
+	if last != nil {
+		wc.send(last)
+	}
+	wc.sock.close()
+}
+
+func (wc *wsConn) send(data []byte) error {
+	if err := wc.sock.send(data); err != nil {
+		return err
+	}
+	wc.mu.Lock()
+	wc.lastSent = time.Now()
+	wc.mu.Unlock()
+	return nil
+}
+
+// register reserves a packet identifier and the channel receiving its acknowledgement.
+func (wc *wsConn) register() (uint16, chan *packet) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	for {
+		wc.nextID++
+		if wc.nextID == 0 {
+			continue
+		}
+		if _, used := wc.acks[wc.nextID]; !used {
+			break
+		}
+	}
+	ack := make(chan *packet, 1)
+	wc.acks[wc.nextID] = ack
+	return wc.nextID, ack
+}
+
+// unregister frees a packet identifier.
+func (wc *wsConn) unregister(id uint16) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	delete(wc.acks, id)
+}
+
+// request sends data and waits for the next acknowledgement on ack.
+func (wc *wsConn) request(ack chan *packet, data []byte) (*packet, error) {
+	if err := wc.send(data); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(wc.timeout)
+	defer timer.Stop()
+	select {
+	case p := <-ack:
+		return p, nil
+	case <-wc.done:
+		return nil, wc.closeErr()
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// receive decodes the packets in data. Called from the onmessage event, so it must not block.
+func (wc *wsConn) receive(data []byte) {
+	wc.mu.Lock()
+	wc.buf = append(wc.buf, data...)
+	packets := []*packet{}
+	for {
+		p, n, err := decodePacket(wc.buf)
+		if err != nil {
+			// Malformed stream, let onclose report the loss.
+			wc.buf = nil
+			wc.mu.Unlock()
+			wc.sock.close()
+			return
+		}
+		if n == 0 {
+			break
+		}
+		packets = append(packets, p)
+		wc.buf = wc.buf[n:]
+	}
+	wc.mu.Unlock()
+	for _, p := range packets {
+		wc.handle(p)
+	}
+}
+
+func (wc *wsConn) handle(p *packet) {
+	switch p.typ {
+	case packetConnack:
+		select {
+		case wc.connack <- p:
+		default:
+		}
+	case packetPublish:
+		msg, id, err := parsePublish(p)
+		if err != nil {
+			return
+		}
+		switch msg.Qos {
+		case 1:
+			wc.send(ackPacket(packetPuback, id))
+		case 2:
+			wc.mu.Lock()
+			dup := wc.received[id]
+			wc.received[id] = true
+			wc.mu.Unlock()
+			wc.send(ackPacket(packetPubrec, id))
+			if dup {
+				return
+			}
+		}
+		wc.c.route(msg)
+	case packetPubrel:
+		if id, err := packetID(p); err == nil {
+			wc.mu.Lock()
+			delete(wc.received, id)
+			wc.mu.Unlock()
+			wc.send(ackPacket(packetPubcomp, id))
+		}
+	case packetPingresp:
+		wc.mu.Lock()
+		wc.pingSent = time.Time{}
+		wc.mu.Unlock()
+	case packetPuback, packetPubrec, packetPubcomp, packetSuback, packetUnsuback:
+		id, err := packetID(p)
+		if err != nil {
+			return
+		}
+		wc.mu.Lock()
+		ack := wc.acks[id]
+		wc.mu.Unlock()
+		if ack != nil {
+			select {
+			case ack <- p:
+			default:
+			}
+		}
+	}
+}
+
+// ping sends PINGREQ when the client has sent nothing for half the keepalive period
+// (the broker only counts packets sent by the client), and closes the connection when
+// the broker does not answer within the keepalive period.
+func (wc *wsConn) ping() {
+	ticker := time.NewTicker(wc.keepAlive / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wc.done:
+			return
+		}
+		wc.mu.Lock()
+		idle := time.Since(wc.lastSent)
+		waiting := !wc.pingSent.IsZero()
+		late := waiting && time.Since(wc.pingSent) > wc.keepAlive
+		wc.mu.Unlock()
+		if late {
+			// No PINGRESP, let closed report the loss.
+			wc.sock.close()
+			return
+		}
+		if !waiting && idle >= wc.keepAlive/2 {
+			if wc.send(encodePacket(packetPingreq, 0, nil)) == nil {
+				wc.mu.Lock()
+				wc.pingSent = time.Now()
+				wc.mu.Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker. Its connections are sockets
+// plugged directly into wsConn, so the client protocol runs without a WebSocket.
+type testBroker struct {
+	mu      sync.Mutex
+	conns   []*brokerConn
+	connack byte // CONNACK return code
+}
+
+type brokerConn struct {
+	b  *testBroker
+	wc *wsConn
+
+	mu     sync.Mutex
+	buf    []byte
+	subs   map[string]bool
+	got    []byte // types of the packets received from the client
+	closed bool
+	nextID uint16
+	out    chan []byte // data for the client, delivered in order
+}
+
+func (b *testBroker) attach(wc *wsConn) *brokerConn {
+	bc := &brokerConn{b: b, wc: wc, subs: map[string]bool{}, out: make(chan []byte, 1024)}
+	b.mu.Lock()
+	b.conns = append(b.conns, bc)
+	b.mu.Unlock()
+	wc.sock = bc
+	go func() {
+		for data := range bc.out {
+			wc.receive(data)
+		}
+		wc.closed()
+	}()
+	return bc
+}
+
+func (b *testBroker) route(msg *Message) {
+	b.mu.Lock()
+	conns := append([]*brokerConn(nil), b.conns...)
+	b.mu.Unlock()
+	for _, bc := range conns {
+		bc.mu.Lock()
+		matched := false
+		for filter := range bc.subs {
+			matched = matched || Match(filter, msg.Topic)
+		}
+		bc.mu.Unlock()
+		if matched {
+			bc.publish(msg)
+		}
+	}
+}
+
+func (bc *brokerConn) push(data []byte) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if !bc.closed {
+		bc.out <- data
+	}
+}
+
+// publish sends msg to the client, returning the packet identifier used.
+func (bc *brokerConn) publish(msg *Message) uint16 {
+	bc.mu.Lock()
+	bc.nextID++
+	id := bc.nextID
+	bc.mu.Unlock()
+	bc.push(publishPacket(msg, id))
+	return id
+}
+
+// received returns the types of the packets received from the client.
+func (bc *brokerConn) received() []byte {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return append([]byte(nil), bc.got...)
+}
+
+func (bc *brokerConn) send(data []byte) error {
+	bc.mu.Lock()
+	if bc.closed {
+		bc.mu.Unlock()
+		return ErrConnectionLost
+	}
+	bc.buf = append(bc.buf, data...)
+	packets := []*packet{}
+	for {
+		p, n, err := decodePacket(bc.buf)
+		if err != nil {
+			bc.mu.Unlock()
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		bc.buf = bc.buf[n:]
+		bc.got = append(bc.got, p.typ)
+		packets = append(packets, p)
+	}
+	bc.mu.Unlock()
+	for _, p := range packets {
+		bc.handle(p)
+	}
+	return nil
+}
+
+func (bc *brokerConn) close() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if !bc.closed {
+		bc.closed = true
+		close(bc.out)
+	}
+}
+
+func (bc *brokerConn) handle(p *packet) {
+	switch p.typ {
+	case packetConnect:
+		bc.push(encodePacket(packetConnack, 0, []byte{0, bc.b.connack}))
+	case packetSubscribe:
+		id, _ := packetID(p)
+		filter, rest, _ := readString(p.body[2:])
+		bc.mu.Lock()
+		bc.subs[filter] = true
+		bc.mu.Unlock()
+		bc.push(encodePacket(packetSuback, 0, []byte{byte(id >> 8), byte(id), rest[0]}))
+	case packetUnsubscribe:
+		id, _ := packetID(p)
+		filter, _, _ := readString(p.body[2:])
+		bc.mu.Lock()
+		delete(bc.subs, filter)
+		bc.mu.Unlock()
+		bc.push(ackPacket(packetUnsuback, id))
+	case packetPublish:
+		msg, id, _ := parsePublish(p)
+		switch msg.Qos {
+		case 1:
+			bc.push(ackPacket(packetPuback, id))
+		case 2:
+			bc.push(ackPacket(packetPubrec, id))
+		}
+		bc.b.route(msg)
+	case packetPubrel:
+		id, _ := packetID(p)
+		bc.push(ackPacket(packetPubcomp, id))
+	case packetPubrec:
+		id, _ := packetID(p)
+		bc.push(ackPacket(packetPubrel, id))
+	case packetPingreq:
+		bc.push(encodePacket(packetPingresp, 0, nil))
+	case packetDisconnect:
+		bc.close()
+	}
+}
+
+// connectTest returns a client connected to b without going through a WebSocket.
+func connectTest(t *testing.T, b *testBroker, keepAlive time.Duration) (*Client, *brokerConn) {
+	t.Helper()
+	c := NewClient(ConnectOptions{URL: "ws://broker", Port: 80, ClientID: "test", KeepAlive: keepAlive, ConnectionTimeout: time.Second})
+	opts := c.Options()
+	wc := newWSConn(c, &opts, c.connectionLost)
+	bc := b.attach(wc)
+	if err := wc.handshake(&opts); err != nil {
+		t.Fatal(err)
+	}
+	go wc.ping()
+	c.mu.Lock()
+	c.tr = &wsTransport{c: c, conn: wc}
+	c.state = StateConnected
+	c.done = make(chan struct{})
+	c.mu.Unlock()
+	t.Cleanup(func() {
+		c.Disconnect()
+	})
+	return c, bc
+}
+
+// waitSequence waits until the packet types in seq appear, in order, among the packets sent by the client.
+func waitSequence(t *testing.T, bc *brokerConn, seq ...byte) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := bc.received()
+		i := 0
+		for _, typ := range got {
+			if i < len(seq) && typ == seq[i] {
+				i++
+			}
+		}
+		if i == len(seq) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client sent %v, want subsequence %v", got, seq)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, s *Subscription) Message {
+	t.Helper()
+	select {
+	case msg := <-s.Messages():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+func TestWSConnectRefused(t *testing.T) {
+	b := &testBroker{connack: 5}
+	c := NewClient(ConnectOptions{ClientID: "test", ConnectionTimeout: time.Second})
+	opts := c.Options()
+	wc := newWSConn(c, &opts, nil)
+	b.attach(wc)
+	if err := wc.handshake(&opts); !errors.Is(err, ErrRefused) {
+		t.Fatalf("handshake = %v, want ErrRefused", err)
+	}
+}
+
+func TestWSPublishQoS(t *testing.T) {
+	tests := []struct {
+		qos      int
+		outbound []byte // packets sent by the client to publish
+		inbound  []byte // packets sent by the client to acknowledge the delivery
+	}{
+		{0, []byte{packetPublish}, nil},
+		{1, []byte{packetPublish}, []byte{packetPuback}},
+		{2, []byte{packetPublish, packetPubrel}, []byte{packetPubrec, packetPubcomp}},
+	}
+	for _, tt := range tests {
+		b := &testBroker{}
+		c, bc := connectTest(t, b, time.Minute)
+		s, err := c.Subscribe("a/+", tt.qos)
+		if err != nil {
+			t.Fatalf("qos %d: subscribe: %v", tt.qos, err)
+		}
+		payload := []byte{0, 1, 2, 0xff}
+		if err := c.PublishBytes("a/b", payload, tt.qos, false); err != nil {
+			t.Fatalf("qos %d: publish: %v", tt.qos, err)
+		}
+		msg := receive(t, s)
+		if msg.Topic != "a/b" || !bytes.Equal(msg.Payload, payload) || msg.Qos != tt.qos {
+			t.Errorf("qos %d: received %+v", tt.qos, msg)
+		}
+		waitSequence(t, bc, append([]byte{packetSubscribe}, tt.outbound...)...)
+		if tt.inbound != nil {
+			waitSequence(t, bc, tt.inbound...)
+		}
+		if err := s.Unsubscribe(); err != nil {
+			t.Errorf("qos %d: unsubscribe: %v", tt.qos, err)
+		}
+		waitSequence(t, bc, packetUnsubscribe)
+	}
+}
+
+func TestWSQoS2Duplicate(t *testing.T) {
+	b := &testBroker{}
+	c, bc := connectTest(t, b, time.Minute)
+	count := make(chan struct{}, 10)
+	if err := c.SubscribeTopic("dup", 2, func(string) { count <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{Topic: "dup", Payload: []byte("x"), Qos: 2}
+	first := publishPacket(msg, 42)
+	msg.Duplicate = true
+	// The retransmission arrives before the client could see the PUBREL.
+	bc.push(append(first, publishPacket(msg, 42)...))
+	waitSequence(t, bc, packetPubrec, packetPubrec, packetPubcomp)
+	time.Sleep(20 * time.Millisecond)
+	if n := len(count); n != 1 {
+		t.Fatalf("delivered %d times, want 1", n)
+	}
+}
+
+func TestWSKeepAliveWhileReceiving(t *testing.T) {
+	b := &testBroker{}
+	c, bc := connectTest(t, b, 200*time.Millisecond)
+	if err := c.SubscribeTopic("in", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The client only receives QoS 0 traffic, it still has to send PINGREQ.
+	stop := time.After(400 * time.Millisecond)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for sending := true; sending; {
+		select {
+		case <-ticker.C:
+			bc.publish(&Message{Topic: "in", Payload: []byte("x")})
+		case <-stop:
+			sending = false
+		}
+	}
+	waitSequence(t, bc, packetPingreq)
+	if !c.Connected() {
+		t.Fatal("client disconnected")
+	}
+}
@@ -0,0 +1,203 @@
+package nativestorage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchError aggregates the per key failures of Batch.Commit.
+type BatchError struct {
+	Errors         map[string]error // Failed operations by key
+	RollbackErrors map[string]error // Keys that could not be restored (AllOrNothing mode)
+}
+
+func (be *BatchError) Error() string {
+	msgs := []string{}
+	for _, k := range sortedKeys(be.Errors) {
+		msgs = append(msgs, k+": "+be.Errors[k].Error())
+	}
+	for _, k := range sortedKeys(be.RollbackErrors) {
+		msgs = append(msgs, k+" (rollback): "+be.RollbackErrors[k].Error())
+	}
+	return "Storage error: Batch failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns every aggregated error.
+func (be *BatchError) Unwrap() []error {
+	res := []error{}
+	for _, k := range sortedKeys(be.Errors) {
+		res = append(res, be.Errors[k])
+	}
+	for _, k := range sortedKeys(be.RollbackErrors) {
+		res = append(res, be.RollbackErrors[k])
+	}
+	return res
+}
+
+func sortedKeys(m map[string]error) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type batchOp struct {
+	key    string
+	val    interface{}
+	remove bool
+}
+
+// Batch collects set and remove operations that Commit runs concurrently against the default store.
+type Batch struct {
+	// AllOrNothing makes Commit restore the previous value of every key in the batch when any operation fails.
+	AllOrNothing bool
+
+	ops []batchOp
+}
+
+// NewBatch returns an empty Batch.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Set queues storing val under key.
+func (b *Batch) Set(key string, val interface{}) *Batch {
+	b.ops = append(b.ops, batchOp{key: key, val: val})
+	return b
+}
+
+// Remove queues removing key.
+func (b *Batch) Remove(key string) *Batch {
+	b.ops = append(b.ops, batchOp{key: key, remove: true})
+	return b
+}
+
+// Len returns the number of queued operations.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Commit runs the queued operations. See CommitContext.
+func (b *Batch) Commit() error {
+	return b.CommitContext(context.Background())
+}
+
+// CommitContext runs the queued operations concurrently; when a key is queued several times only the last
+// operation is applied. Failures are reported in a single *BatchError.
+func (b *Batch) CommitContext(ctx context.Context) error {
+	ops := dedupOps(b.ops)
+	var prev map[string]interface{}
+	if b.AllOrNothing {
+		var err error
+		if prev, err = snapshot(ctx, ops); err != nil {
+			return err
+		}
+	}
+	errs := runOps(ctx, ops)
+	if len(errs) == 0 {
+		return nil
+	}
+	be := &BatchError{Errors: errs}
+	if b.AllOrNothing {
+		// Failed keys are restored too: an operation that timed out may still be applied by the plugin.
+		rollback := []batchOp{}
+		for _, op := range ops {
+			if old, ok := prev[op.key]; ok {
+				rollback = append(rollback, batchOp{key: op.key, val: old})
+			} else {
+				rollback = append(rollback, batchOp{key: op.key, remove: true})
+			}
+		}
+		if rerrs := runOps(context.Background(), rollback); len(rerrs) > 0 {
+			be.RollbackErrors = rerrs
+		}
+	}
+	return be
+}
+
+func dedupOps(ops []batchOp) []batchOp {
+	last := map[string]int{}
+	for i, op := range ops {
+		last[op.key] = i
+	}
+	res := []batchOp{}
+	for i, op := range ops {
+		if last[op.key] == i {
+			res = append(res, op)
+		}
+	}
+	return res
+}
+
+// snapshot reads the current value of every key; missing keys are left out.
+func snapshot(ctx context.Context, ops []batchOp) (map[string]interface{}, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	prev := map[string]interface{}{}
+	errs := map[string]error{}
+	for _, op := range ops {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			val, err := getRaw(ctx, key)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				prev[key] = val
+			case !errors.Is(err, ErrNotFound):
+				errs[key] = err
+			}
+		}(op.key)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, &BatchError{Errors: errs}
+	}
+	return prev, nil
+}
+
+// getRaw returns the value stored under key as accepted back by SetItem: a Go value for a GoStore,
+// otherwise the *js.Object.
+func getRaw(ctx context.Context, key string) (interface{}, error) {
+	if gs, ok := DefaultStore().(GoStore); ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return gs.GetItem(key)
+	}
+	return GetItemJSContext(ctx, key)
+}
+
+// runOps applies ops concurrently and returns the failures by key.
+func runOps(ctx context.Context, ops []batchOp) map[string]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+	for _, op := range ops {
+		wg.Add(1)
+		go func(op batchOp) {
+			defer wg.Done()
+			var err error
+			if op.remove {
+				if err = RemoveItemContext(ctx, op.key); errors.Is(err, ErrNotFound) {
+					err = nil
+				}
+			} else {
+				err = SetItemContext(ctx, op.key, op.val)
+			}
+			if err != nil {
+				mu.Lock()
+				errs[op.key] = err
+				mu.Unlock()
+			}
+		}(op)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,181 @@
+package nativestorage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrVersion is returned by OpenNamespace when the stored schema version is newer than the requested one.
+	ErrVersion = errors.New("Storage error: Namespace version is newer than expected")
+	// ErrInvalidKey is returned for a namespace prefix that is empty or contains ':', and for reserved key names.
+	ErrInvalidKey = errors.New("Storage error: Invalid namespace prefix or key")
+)
+
+const (
+	nsSeparator  = ":"
+	nsIndexKey   = "__keys"
+	nsVersionKey = "__version"
+)
+
+// Migration upgrades a namespace to Version. It runs on OpenNamespace when the stored version is lower.
+type Migration struct {
+	Version int
+	Up      func(ns *Namespace) error
+}
+
+// Namespace is a view of the storage where every key is prefixed, so several modules can share the
+// plugin keyspace without clashing. The plugin cannot list keys, so the namespace keeps its own index.
+type Namespace struct {
+	prefix  string
+	version int
+	mu      sync.Mutex
+	keys    map[string]bool
+}
+
+// OpenNamespace opens the namespace prefix with schema version, running the migrations whose Version is
+// greater than the stored one (in ascending order) and up to version.
+// The prefix must not be empty nor contain ':', so namespaces can't overlap.
+func OpenNamespace(prefix string, version int, migrations ...Migration) (*Namespace, error) {
+	if prefix == "" || strings.Contains(prefix, nsSeparator) {
+		return nil, fmt.Errorf("%w: prefix %q", ErrInvalidKey, prefix)
+	}
+	ns := &Namespace{prefix: prefix, keys: map[string]bool{}}
+	keys, err := Get[[]string](ns.key(nsIndexKey))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	for _, k := range keys {
+		ns.keys[k] = true
+	}
+	stored, err := Get[int](ns.key(nsVersionKey))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if stored > version {
+		return nil, fmt.Errorf("%w: %s is at version %d, want %d", ErrVersion, prefix, stored, version)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for _, m := range migrations {
+		if m.Version <= stored || m.Version > version {
+			continue
+		}
+		ns.version = stored
+		if err := m.Up(ns); err != nil {
+			return nil, fmt.Errorf("migrating %s to version %d: %w", prefix, m.Version, err)
+		}
+		if err := Put(ns.key(nsVersionKey), m.Version); err != nil {
+			return nil, err
+		}
+		stored = m.Version
+	}
+	if stored != version {
+		if err := Put(ns.key(nsVersionKey), version); err != nil {
+			return nil, err
+		}
+	}
+	ns.version = version
+	return ns, nil
+}
+
+func (ns *Namespace) key(k string) string {
+	return ns.prefix + nsSeparator + k
+}
+
+// checkKey rejects the key names used by the namespace itself.
+func checkKey(key string) error {
+	if key == nsIndexKey || key == nsVersionKey {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+func (ns *Namespace) saveIndex() error {
+	keys := make([]string, 0, len(ns.keys))
+	for k := range ns.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return Put(ns.key(nsIndexKey), keys)
+}
+
+// Prefix returns the namespace prefix.
+func (ns *Namespace) Prefix() string {
+	return ns.prefix
+}
+
+// Version returns the namespace schema version (the version being migrated from while a Migration runs).
+func (ns *Namespace) Version() int {
+	return ns.version
+}
+
+// Set encodes v with DefaultCodec and stores it under key. The names "__keys" and "__version" are reserved.
+func (ns *Namespace) Set(key string, v interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := Put(ns.key(key), v); err != nil {
+		return err
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.keys[key] {
+		return nil
+	}
+	ns.keys[key] = true
+	return ns.saveIndex()
+}
+
+// Get decodes the value stored under key into v, which must be a pointer.
+func (ns *Namespace) Get(key string, v interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s, err := GetString(ns.key(key))
+	if err != nil {
+		return err
+	}
+	return decode(s, v)
+}
+
+// Remove removes key from the namespace.
+func (ns *Namespace) Remove(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := RemoveItem(ns.key(key)); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if !ns.keys[key] {
+		return nil
+	}
+	delete(ns.keys, key)
+	return ns.saveIndex()
+}
+
+// Keys returns the namespace keys in lexical order.
+func (ns *Namespace) Keys() []string {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	keys := make([]string, 0, len(ns.keys))
+	for k := range ns.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes every key of the namespace, leaving the rest of the storage and the schema version untouched.
+func (ns *Namespace) Clear() error {
+	for _, k := range ns.Keys() {
+		if err := ns.Remove(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
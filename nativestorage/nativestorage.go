@@ -1,7 +1,12 @@
 package nativestorage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gopherjs/gopherjs/js"
 )
@@ -18,18 +23,46 @@ var (
 
 var instance *js.Object
 
+// mo returns the plugin object. Only a found plugin is cached, as it is not defined before deviceready.
 func mo() *js.Object {
 	if instance == nil {
-		instance = js.Global.Get("NativeStorage")
+		if ob := js.Global.Get("NativeStorage"); ob != nil && ob != js.Undefined {
+			instance = ob
+		}
 	}
 	return instance
 }
 
+// ErrTimeout is returned when the plugin does not answer within DefaultTimeout and the context has no deadline.
+var ErrTimeout = errors.New("Storage error: Timeout")
+
+// DefaultTimeout bounds the wait for every plugin answer when the context has no deadline. Zero disables it.
+var DefaultTimeout = 10 * time.Second
+
+// wait blocks until ch is closed, ctx is done or, if ctx has no deadline, DefaultTimeout elapses.
+// Callbacks arriving later are harmless thanks to safeClose.
+func wait(ctx context.Context, ch chan struct{}) error {
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok && DefaultTimeout > 0 {
+		t := time.NewTimer(DefaultTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrTimeout
+	}
+}
+
 func safeClose(ch chan struct{}) {
 	select {
-		case <- ch:
-		default:
-			close(ch)
+	case <-ch:
+	default:
+		close(ch)
 	}
 }
 
@@ -51,7 +84,14 @@ func errorByCode(code int) error {
 	return ErrUnknown
 }
 
-func SetItem(key string, val interface{}) (err error) {
+// PluginStore is the Store backed by the NativeStorage plugin.
+type PluginStore struct{}
+
+func (p PluginStore) SetItem(key string, val interface{}) error {
+	return p.SetItemContext(context.Background(), key, val)
+}
+
+func (PluginStore) SetItemContext(ctx context.Context, key string, val interface{}) (err error) {
 	ch := make(chan struct{})
 	success := func() {
 		safeClose(ch)
@@ -61,11 +101,17 @@ func SetItem(key string, val interface{}) (err error) {
 		safeClose(ch)
 	}
 	mo().Call("setItem", key, val, success, fail)
-	<-ch
+	if werr := wait(ctx, ch); werr != nil {
+		return werr
+	}
 	return
 }
 
-func GetItemJS(key string) (ret *js.Object, err error) {
+func (p PluginStore) GetItemJS(key string) (*js.Object, error) {
+	return p.GetItemJSContext(context.Background(), key)
+}
+
+func (PluginStore) GetItemJSContext(ctx context.Context, key string) (ret *js.Object, err error) {
 	ch := make(chan struct{})
 	success := func(obj *js.Object) {
 		ret = obj
@@ -76,11 +122,146 @@ func GetItemJS(key string) (ret *js.Object, err error) {
 		safeClose(ch)
 	}
 	mo().Call("getItem", key, success, fail)
-	<-ch
+	if werr := wait(ctx, ch); werr != nil {
+		return nil, werr
+	}
+	return
+}
+
+func (p PluginStore) RemoveItem(key string) error {
+	return p.RemoveItemContext(context.Background(), key)
+}
+
+func (PluginStore) RemoveItemContext(ctx context.Context, key string) (err error) {
+	ch := make(chan struct{})
+	success := func() {
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = errorByCode(obj.Get("code").Int())
+		safeClose(ch)
+	}
+	mo().Call("remove", key, success, fail)
+	if werr := wait(ctx, ch); werr != nil {
+		return werr
+	}
+	return
+}
+
+func (p PluginStore) RemoveAll() error {
+	return p.RemoveAllContext(context.Background())
+}
+
+func (PluginStore) RemoveAllContext(ctx context.Context) (err error) {
+	ch := make(chan struct{})
+	success := func() {
+		safeClose(ch)
+	}
+	fail := func(obj *js.Object) {
+		err = errorByCode(obj.Get("code").Int())
+		safeClose(ch)
+	}
+	mo().Call("clear", success, fail)
+	if werr := wait(ctx, ch); werr != nil {
+		return werr
+	}
 	return
 }
 
+// SetItem stores val under key in the default store.
+func SetItem(key string, val interface{}) error {
+	return SetItemContext(context.Background(), key, val)
+}
+
+// SetItemContext is like SetItem but returns ctx.Err() if ctx is done before the store answers.
+func SetItemContext(ctx context.Context, key string, val interface{}) error {
+	if cs, ok := DefaultStore().(ContextStore); ok {
+		return cs.SetItemContext(ctx, key, val)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return DefaultStore().SetItem(key, val)
+}
+
+// GetItemJS returns the raw value stored under key in the default store.
+func GetItemJS(key string) (*js.Object, error) {
+	return GetItemJSContext(context.Background(), key)
+}
+
+// GetItemJSContext is like GetItemJS but returns ctx.Err() if ctx is done before the store answers.
+func GetItemJSContext(ctx context.Context, key string) (*js.Object, error) {
+	if cs, ok := DefaultStore().(ContextStore); ok {
+		return cs.GetItemJSContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return DefaultStore().GetItemJS(key)
+}
+
+// RemoveItem removes key from the default store.
+func RemoveItem(key string) error {
+	return RemoveItemContext(context.Background(), key)
+}
+
+// RemoveItemContext is like RemoveItem but returns ctx.Err() if ctx is done before the store answers.
+func RemoveItemContext(ctx context.Context, key string) error {
+	if cs, ok := DefaultStore().(ContextStore); ok {
+		return cs.RemoveItemContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return DefaultStore().RemoveItem(key)
+}
+
+// RemoveAll removes every key from the default store.
+func RemoveAll() error {
+	return RemoveAllContext(context.Background())
+}
+
+// RemoveAllContext is like RemoveAll but returns ctx.Err() if ctx is done before the store answers.
+func RemoveAllContext(ctx context.Context) error {
+	if cs, ok := DefaultStore().(ContextStore); ok {
+		return cs.RemoveAllContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return DefaultStore().RemoveAll()
+}
+
+// goValue returns the value stored under key when the default store is a GoStore; ok is false otherwise.
+func goValue(key string) (v interface{}, ok bool, err error) {
+	gs, ok := DefaultStore().(GoStore)
+	if !ok {
+		return nil, false, nil
+	}
+	v, err = gs.GetItem(key)
+	return v, true, err
+}
+
+// number converts a value decoded by encoding/json like JS Number() would.
+func number(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
+
 func GetItem(key string) (interface{}, error) {
+	if v, ok, err := goValue(key); ok {
+		return v, err
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return nil, e
@@ -89,6 +270,9 @@ func GetItem(key string) (interface{}, error) {
 }
 
 func GetInt(key string) (int, error) {
+	if v, ok, err := goValue(key); ok {
+		return int(number(v)), err
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return 0, e
@@ -97,6 +281,9 @@ func GetInt(key string) (int, error) {
 }
 
 func GetInt64(key string) (int64, error) {
+	if v, ok, err := goValue(key); ok {
+		return int64(number(v)), err
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return 0, e
@@ -105,6 +292,9 @@ func GetInt64(key string) (int64, error) {
 }
 
 func GetFloat64(key string) (float64, error) {
+	if v, ok, err := goValue(key); ok {
+		return number(v), err
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return 0, e
@@ -113,6 +303,18 @@ func GetFloat64(key string) (float64, error) {
 }
 
 func GetString(key string) (string, error) {
+	if v, ok, err := goValue(key); ok {
+		if err != nil {
+			return "", err
+		}
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case nil:
+			return "null", nil
+		}
+		return fmt.Sprint(v), nil
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return "", e
@@ -121,37 +323,22 @@ func GetString(key string) (string, error) {
 }
 
 func GetBool(key string) (bool, error) {
+	if v, ok, err := goValue(key); ok {
+		switch v := v.(type) {
+		case nil:
+			return false, err
+		case bool:
+			return v, err
+		case float64:
+			return v != 0, err
+		case string:
+			return v != "", err
+		}
+		return true, err
+	}
 	r, e := GetItemJS(key)
 	if e != nil {
 		return false, e
 	}
 	return r.Bool(), nil
 }
-
-func RemoveItem(key string) (err error) {
-	ch := make(chan struct{})
-	success := func() {
-		safeClose(ch)
-	}
-	fail := func(obj *js.Object) {
-		err = errorByCode(obj.Get("code").Int())
-		safeClose(ch)
-	}
-	mo().Call("remove", key, success, fail)
-	<-ch
-	return
-}
-
-func RemoveAll() (err error) {
-	ch := make(chan struct{})
-	success := func() {
-		safeClose(ch)
-	}
-	fail := func(obj *js.Object) {
-		err = errorByCode(obj.Get("code").Int())
-		safeClose(ch)
-	}
-	mo().Call("clear", success, fail)
-	<-ch
-	return
-}
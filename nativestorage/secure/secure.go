@@ -0,0 +1,334 @@
+// Package secure stores nativestorage values encrypted with AES-GCM.
+//
+// Values are kept in a nativestorage.Namespace, so the set of encrypted keys is tracked and
+// can be re-encrypted on key rotation. Each value is bound to its key name, so moving ciphertexts
+// between keys is detected as tampering.
+//
+// Install plugin:
+//  cordova plugin add cordova-plugin-nativestorage
+package secure
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jaracil/goco/nativestorage"
+)
+
+var (
+	// ErrDecrypt is returned when a value cannot be decrypted, either because the key is wrong or the data was tampered with.
+	ErrDecrypt = errors.New("Secure storage error: Decryption failed (wrong key or tampered data)")
+	// ErrKeySize is returned when the supplied key is not 16, 24 or 32 bytes long.
+	ErrKeySize = errors.New("Secure storage error: Invalid key size")
+	// ErrSalt is returned when the stored salt is corrupt. The salt is never regenerated, as that would make
+	// every stored value undecryptable.
+	ErrSalt = errors.New("Secure storage error: Invalid salt")
+)
+
+// Iterations is the PBKDF2-SHA256 iteration count used to derive keys from secrets.
+var Iterations = 100000
+
+// The salt and journal keys have no ':' after the prefix, so they are outside the namespace keyspace
+// (namespace keys are "prefix:key" and prefixes can't contain ':').
+const (
+	saltKey     = "#salt"     // Current salt
+	rotationKey = "#rotation" // Journal of a RotateSecret in progress
+	saltSize    = 16
+	keySize     = 32
+)
+
+// rotation is the journal of a RotateSecret: the new salt and every value sealed with the new key.
+type rotation struct {
+	Salt   []byte
+	Values map[string]string
+}
+
+// Store encrypts values before handing them to nativestorage.
+type Store struct {
+	ns   *nativestorage.Namespace
+	aead cipher.AEAD
+}
+
+// Open opens the encrypted store prefix using key, which must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+func Open(prefix string, key []byte) (*Store, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := nativestorage.OpenNamespace(prefix, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{ns: ns, aead: aead}, nil
+}
+
+// OpenWithSecret opens the encrypted store prefix using an AES-256 key derived from secret with PBKDF2.
+// A random salt is generated on first use and kept in the storage.
+// A RotateSecret interrupted before switching the salt is rolled back, and one interrupted afterwards is completed,
+// so the store opens with the secret in use at the time of the interruption.
+func OpenWithSecret(prefix string, secret string) (*Store, error) {
+	ns, err := nativestorage.OpenNamespace(prefix, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := recoverRotation(ns); err != nil {
+		return nil, err
+	}
+	salt, err := loadSalt(prefix)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(deriveKey(secret, salt))
+	if err != nil {
+		return nil, err
+	}
+	return &Store{ns: ns, aead: aead}, nil
+}
+
+// recoverRotation finishes or rolls back an interrupted RotateSecret. It needs no secret, as the journal
+// holds the values already sealed with the new key.
+func recoverRotation(ns *nativestorage.Namespace) error {
+	prefix := ns.Prefix()
+	r, err := nativestorage.Get[rotation](prefix + rotationKey)
+	if errors.Is(err, nativestorage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	salt, err := getSalt(prefix + saltKey)
+	if err != nil && !errors.Is(err, nativestorage.ErrNotFound) {
+		return err
+	}
+	if bytes.Equal(salt, r.Salt) {
+		// The new salt was committed, write the remaining values.
+		if err := write(ns, r.Values); err != nil {
+			return err
+		}
+	}
+	return nativestorage.RemoveItem(prefix + rotationKey)
+}
+
+// getSalt reads the salt stored under key, returning ErrSalt if it is corrupt.
+func getSalt(key string) ([]byte, error) {
+	salt, err := nativestorage.Get[[]byte](key)
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) != saltSize {
+		return nil, fmt.Errorf("%w: %s has %d bytes", ErrSalt, key, len(salt))
+	}
+	return salt, nil
+}
+
+func loadSalt(prefix string) ([]byte, error) {
+	salt, err := getSalt(prefix + saltKey)
+	if !errors.Is(err, nativestorage.ErrNotFound) {
+		return salt, err
+	}
+	if salt, err = newSalt(); err != nil {
+		return nil, err
+	}
+	if err := nativestorage.Put(prefix+saltKey, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey implements PBKDF2 with HMAC-SHA256 (RFC 8018) for a single output block.
+func deriveKey(secret string, salt []byte) []byte {
+	prf := hmac.New(sha256.New, []byte(secret))
+	prf.Write(salt)
+	prf.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < Iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key[:keySize]
+}
+
+func seal(aead cipher.AEAD, key string, plain []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, []byte(key))), nil
+}
+
+func open(aead cipher.AEAD, key string, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// Set encrypts val and stores it under key.
+func (s *Store) Set(key string, val []byte) error {
+	sealed, err := seal(s.aead, key, val)
+	if err != nil {
+		return err
+	}
+	return s.ns.Set(key, sealed)
+}
+
+// Get returns the decrypted value stored under key. It returns ErrDecrypt if the value was tampered with.
+func (s *Store) Get(key string) ([]byte, error) {
+	var sealed string
+	if err := s.ns.Get(key, &sealed); err != nil {
+		return nil, err
+	}
+	return open(s.aead, key, sealed)
+}
+
+// SetItem encodes val with nativestorage.DefaultCodec, encrypts it and stores it under key.
+func (s *Store) SetItem(key string, val interface{}) error {
+	data, err := nativestorage.DefaultCodec.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("%w: %v", nativestorage.ErrCodec, err)
+	}
+	return s.Set(key, data)
+}
+
+// GetItem decrypts the value stored under key by SetItem and decodes it into val, which must be a pointer.
+func (s *Store) GetItem(key string, val interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := nativestorage.DefaultCodec.Unmarshal(data, val); err != nil {
+		return fmt.Errorf("%w: %v", nativestorage.ErrCodec, err)
+	}
+	return nil
+}
+
+// Remove removes key.
+func (s *Store) Remove(key string) error {
+	return s.ns.Remove(key)
+}
+
+// Keys returns the encrypted keys in lexical order.
+func (s *Store) Keys() []string {
+	return s.ns.Keys()
+}
+
+// Clear removes all encrypted keys.
+func (s *Store) Clear() error {
+	return s.ns.Clear()
+}
+
+// Rotate re-encrypts every tracked key with newKey and switches the store to it.
+// All values are decrypted before anything is written, so a wrong current key or a tampered value
+// aborts the rotation without changes. A storage failure while writing may leave keys encrypted with either key.
+func (s *Store) Rotate(newKey []byte) error {
+	aead, err := newAEAD(newKey)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.reseal(aead)
+	if err != nil {
+		return err
+	}
+	if err := write(s.ns, sealed); err != nil {
+		return err
+	}
+	s.aead = aead
+	return nil
+}
+
+// RotateSecret is like Rotate for stores opened with OpenWithSecret, switching to a key derived from secret
+// with a new salt. The re-encrypted values are journaled before the salt is switched, so a rotation
+// interrupted by a storage failure (or the app exiting) is rolled back or completed by the next
+// OpenWithSecret, and the store is never left with values encrypted under different keys.
+// The journal holds a copy of every value, so the storage needs room for it.
+func (s *Store) RotateSecret(secret string) error {
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(deriveKey(secret, salt))
+	if err != nil {
+		return err
+	}
+	sealed, err := s.reseal(aead)
+	if err != nil {
+		return err
+	}
+	prefix := s.ns.Prefix()
+	if err := nativestorage.Put(prefix+rotationKey, rotation{Salt: salt, Values: sealed}); err != nil {
+		return err
+	}
+	if err := nativestorage.Put(prefix+saltKey, salt); err != nil {
+		return err
+	}
+	// Committed: from here on the next OpenWithSecret completes the rotation.
+	s.aead = aead
+	if err := write(s.ns, sealed); err != nil {
+		return err
+	}
+	return nativestorage.RemoveItem(prefix + rotationKey)
+}
+
+// reseal decrypts every tracked key and seals it again with aead.
+func (s *Store) reseal(aead cipher.AEAD) (map[string]string, error) {
+	sealed := map[string]string{}
+	for _, k := range s.Keys() {
+		data, err := s.Get(k)
+		if err != nil {
+			return nil, fmt.Errorf("rotating %q: %w", k, err)
+		}
+		if sealed[k], err = seal(aead, k, data); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+// write stores the sealed values in ns.
+func write(ns *nativestorage.Namespace, sealed map[string]string) error {
+	for k, v := range sealed {
+		if err := ns.Set(k, v); err != nil {
+			return fmt.Errorf("rotating %q: %w", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package secure
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jaracil/goco/nativestorage"
+)
+
+// failStore is a MemoryStore failing the writes of one key.
+type failStore struct {
+	*nativestorage.MemoryStore
+	fail string
+}
+
+func (f *failStore) SetItem(key string, val interface{}) error {
+	if key == f.fail {
+		return nativestorage.ErrWriteFailed
+	}
+	return f.MemoryStore.SetItem(key, val)
+}
+
+func setup(t *testing.T) *failStore {
+	saved := Iterations
+	Iterations = 10
+	fs := &failStore{MemoryStore: nativestorage.NewMemoryStore()}
+	nativestorage.SetDefaultStore(fs)
+	t.Cleanup(func() {
+		Iterations = saved
+		nativestorage.SetDefaultStore(nil)
+	})
+	return fs
+}
+
+var values = map[string]string{"a": "alpha", "b": "beta", "c": "gamma"}
+
+func fill(t *testing.T, secret string) *Store {
+	t.Helper()
+	s, err := OpenWithSecret("sec", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		if err := s.Set(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// check opens the store with secret and verifies every value.
+func check(t *testing.T, secret string) {
+	t.Helper()
+	s, err := OpenWithSecret("sec", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		got, err := s.Get(k)
+		if err != nil || string(got) != v {
+			t.Errorf("secret %q: Get(%q) = %q, %v, want %q", secret, k, got, err, v)
+		}
+	}
+	if _, err := nativestorage.GetString("sec" + rotationKey); !errors.Is(err, nativestorage.ErrNotFound) {
+		t.Errorf("journal left after open: %v", err)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	setup(t)
+	s := fill(t, "old")
+	if err := s.RotateSecret("new"); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "new")
+	s, err := OpenWithSecret("sec", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("old secret err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestRotateSecretInterruptedBeforeCommit(t *testing.T) {
+	fs := setup(t)
+	s := fill(t, "old")
+	fs.fail = "sec" + saltKey
+	if err := s.RotateSecret("new"); !errors.Is(err, nativestorage.ErrWriteFailed) {
+		t.Fatalf("RotateSecret = %v, want ErrWriteFailed", err)
+	}
+	fs.fail = ""
+	// The salt was not switched, the rotation is rolled back.
+	check(t, "old")
+}
+
+func TestRotateSecretInterruptedAfterCommit(t *testing.T) {
+	fs := setup(t)
+	s := fill(t, "old")
+	fs.fail = "sec:b"
+	if err := s.RotateSecret("new"); !errors.Is(err, nativestorage.ErrWriteFailed) {
+		t.Fatalf("RotateSecret = %v, want ErrWriteFailed", err)
+	}
+	fs.fail = ""
+	// The salt was switched with some values still under the old key, the rotation is completed.
+	check(t, "new")
+}
@@ -0,0 +1,220 @@
+package nativestorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gopherjs/gopherjs/js"
+	"github.com/jaracil/goco"
+)
+
+// Store is a key-value storage backend. Values are JSON serializable JS values,
+// as accepted by the NativeStorage plugin.
+type Store interface {
+	SetItem(key string, val interface{}) error
+	GetItemJS(key string) (*js.Object, error)
+	RemoveItem(key string) error
+	RemoveAll() error
+}
+
+// ContextStore is implemented by stores whose operations may block, such as PluginStore.
+// Package level ...Context functions use it when the default store implements it.
+type ContextStore interface {
+	Store
+	SetItemContext(ctx context.Context, key string, val interface{}) error
+	GetItemJSContext(ctx context.Context, key string) (*js.Object, error)
+	RemoveItemContext(ctx context.Context, key string) error
+	RemoveAllContext(ctx context.Context) error
+}
+
+// GoStore is implemented by stores that return values as Go values, without JS conversions (e.g. MemoryStore).
+// Package level getters use it, so they work in plain Go programs and tests too.
+type GoStore interface {
+	Store
+	// GetItem returns the value stored under key as decoded by encoding/json.
+	GetItem(key string) (interface{}, error)
+}
+
+var (
+	storeMu      sync.Mutex
+	defaultStore Store
+)
+
+// DefaultStore returns the store used by package level functions. Unless set with SetDefaultStore,
+// it is the NativeStorage plugin if installed, otherwise window.localStorage if available
+// (e.g. browser platform), otherwise an in-memory store.
+// Inside Cordova the plugin is only defined after deviceready while localStorage always exists,
+// so the first call waits for deviceready; choosing earlier would split the data between stores.
+func DefaultStore() Store {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if defaultStore == nil {
+		defaultStore = detectStore()
+	}
+	return defaultStore
+}
+
+// SetDefaultStore replaces the store used by package level functions (e.g. with a MemoryStore in tests).
+func SetDefaultStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	defaultStore = s
+}
+
+func detectStore() Store {
+	if cordova := js.Global.Get("cordova"); cordova != nil && cordova != js.Undefined {
+		goco.WaitReady()
+	}
+	ls := js.Global.Get("localStorage")
+	return pickStore(mo() != nil, ls != nil && ls != js.Undefined)
+}
+
+// pickStore returns the store to use given the available backends.
+func pickStore(plugin, localStorage bool) Store {
+	switch {
+	case plugin:
+		return PluginStore{}
+	case localStorage:
+		return LocalStorage{}
+	}
+	return NewMemoryStore()
+}
+
+// jsonEncode returns the JSON text of val as the plugin would store it.
+func jsonEncode(val interface{}) (res string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrJSON
+		}
+	}()
+	ob := js.Global.Get("JSON").Call("stringify", val)
+	if ob == js.Undefined {
+		return "", ErrUndefined
+	}
+	return ob.String(), nil
+}
+
+// jsonDecode parses JSON text stored by jsonEncode.
+func jsonDecode(text string) (res *js.Object, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrJSON
+		}
+	}()
+	return js.Global.Get("JSON").Call("parse", text), nil
+}
+
+// LocalStorage is the Store backed by window.localStorage. Values are kept as JSON text.
+type LocalStorage struct{}
+
+// SetItem returns ErrWriteFailed when localStorage throws (quota exceeded, Safari private mode).
+func (LocalStorage) SetItem(key string, val interface{}) (err error) {
+	text, err := jsonEncode(val)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrWriteFailed
+		}
+	}()
+	js.Global.Get("localStorage").Call("setItem", key, text)
+	return nil
+}
+
+func (LocalStorage) GetItemJS(key string) (*js.Object, error) {
+	text := js.Global.Get("localStorage").Call("getItem", key)
+	if text == nil || text == js.Undefined {
+		return nil, ErrNotFound
+	}
+	return jsonDecode(text.String())
+}
+
+func (LocalStorage) RemoveItem(key string) error {
+	js.Global.Get("localStorage").Call("removeItem", key)
+	return nil
+}
+
+func (LocalStorage) RemoveAll() error {
+	js.Global.Get("localStorage").Call("clear")
+	return nil
+}
+
+// MemoryStore is a Store keeping the values as JSON text (encoded with encoding/json) in a Go map,
+// so it does not need JS. Data is lost when the app exits.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]string{}}
+}
+
+// SetItem stores val, which may be a Go value or a *js.Object.
+func (m *MemoryStore) SetItem(key string, val interface{}) error {
+	var text string
+	if ob, ok := val.(*js.Object); ok {
+		var err error
+		if text, err = jsonEncode(ob); err != nil {
+			return err
+		}
+	} else {
+		data, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrJSON, err)
+		}
+		text = string(data)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = text
+	return nil
+}
+
+func (m *MemoryStore) text(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	text, ok := m.items[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return text, nil
+}
+
+func (m *MemoryStore) GetItem(key string) (interface{}, error) {
+	text, err := m.text(key)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSON, err)
+	}
+	return v, nil
+}
+
+func (m *MemoryStore) GetItemJS(key string) (*js.Object, error) {
+	text, err := m.text(key)
+	if err != nil {
+		return nil, err
+	}
+	return jsonDecode(text)
+}
+
+func (m *MemoryStore) RemoveItem(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+func (m *MemoryStore) RemoveAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = map[string]string{}
+	return nil
+}
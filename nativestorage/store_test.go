@@ -0,0 +1,97 @@
+package nativestorage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func useStore(t *testing.T, s Store) {
+	storeMu.Lock()
+	saved := defaultStore
+	storeMu.Unlock()
+	SetDefaultStore(s)
+	t.Cleanup(func() { SetDefaultStore(saved) })
+}
+
+func TestPickStore(t *testing.T) {
+	if _, ok := pickStore(true, true).(PluginStore); !ok {
+		t.Error("plugin and localStorage: want PluginStore")
+	}
+	if _, ok := pickStore(true, false).(PluginStore); !ok {
+		t.Error("plugin: want PluginStore")
+	}
+	if _, ok := pickStore(false, true).(LocalStorage); !ok {
+		t.Error("localStorage: want LocalStorage")
+	}
+	if _, ok := pickStore(false, false).(*MemoryStore); !ok {
+		t.Error("no backend: want *MemoryStore")
+	}
+}
+
+func TestDefaultStoreKept(t *testing.T) {
+	useStore(t, nil)
+	s := DefaultStore()
+	if _, ok := s.(*MemoryStore); !ok {
+		t.Fatalf("DefaultStore() = %T, want *MemoryStore", s)
+	}
+	if err := SetItem("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if DefaultStore() != s {
+		t.Fatal("DefaultStore changed between calls")
+	}
+	if v, err := GetString("k"); err != nil || v != "v" {
+		t.Fatalf("GetString = %q, %v", v, err)
+	}
+}
+
+func TestMemoryStoreGetters(t *testing.T) {
+	useStore(t, NewMemoryStore())
+	SetItem("int", 42)
+	SetItem("float", 1.5)
+	SetItem("bool", true)
+	SetItem("str", "text")
+	if v, err := GetInt("int"); err != nil || v != 42 {
+		t.Errorf("GetInt = %v, %v", v, err)
+	}
+	if v, err := GetInt64("int"); err != nil || v != 42 {
+		t.Errorf("GetInt64 = %v, %v", v, err)
+	}
+	if v, err := GetFloat64("float"); err != nil || v != 1.5 {
+		t.Errorf("GetFloat64 = %v, %v", v, err)
+	}
+	if v, err := GetBool("bool"); err != nil || !v {
+		t.Errorf("GetBool = %v, %v", v, err)
+	}
+	if v, err := GetString("str"); err != nil || v != "text" {
+		t.Errorf("GetString = %q, %v", v, err)
+	}
+	if v, err := GetItem("int"); err != nil || v != float64(42) {
+		t.Errorf("GetItem = %#v, %v", v, err)
+	}
+	if _, err := GetString("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key err = %v, want ErrNotFound", err)
+	}
+	RemoveItem("str")
+	if _, err := GetString("str"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removed key err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStorePutGet(t *testing.T) {
+	useStore(t, NewMemoryStore())
+	type item struct {
+		Name string
+		At   time.Time
+		Data []byte
+	}
+	in := item{Name: "a", At: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Data: []byte{0, 0xff}}
+	if err := Put("item", in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Get[item]("item")
+	if err != nil || out.Name != in.Name || !out.At.Equal(in.At) || string(out.Data) != string(in.Data) {
+		t.Fatalf("Get = %+v, %v, want %+v", out, err, in)
+	}
+}
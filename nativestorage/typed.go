@@ -0,0 +1,82 @@
+package nativestorage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrCodec is returned when DefaultCodec fails to encode or decode a value.
+var ErrCodec = errors.New("Storage error: Codec error")
+
+// Codec converts Go values to and from the data stored by Put and Get.
+// Unless it implements TextCodec, its output is treated as binary and stored base64 encoded,
+// as the storage only keeps strings.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// TextCodec is implemented by codecs producing UTF-8 text, which is stored as is.
+type TextCodec interface {
+	Codec
+	Text()
+}
+
+// JSONCodec is a Codec based on encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (JSONCodec) Text()                                      {}
+
+// DefaultCodec is the Codec used by Put and Get.
+var DefaultCodec Codec = JSONCodec{}
+
+// encode returns the string stored for v.
+func encode(v interface{}) (string, error) {
+	data, err := DefaultCodec.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+	if _, ok := DefaultCodec.(TextCodec); ok {
+		return string(data), nil
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decode decodes the string stored by encode into v, which must be a pointer.
+func decode(s string, v interface{}) error {
+	data := []byte(s)
+	if _, ok := DefaultCodec.(TextCodec); !ok {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return fmt.Errorf("%w: %v", ErrCodec, err)
+		}
+	}
+	if err := DefaultCodec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+	return nil
+}
+
+// Put encodes v with DefaultCodec and stores it under key.
+// Unlike SetItem, Go structs, time.Time and []byte values round-trip unchanged through Get.
+func Put[T any](key string, v T) error {
+	s, err := encode(v)
+	if err != nil {
+		return err
+	}
+	return SetItem(key, s)
+}
+
+// Get reads the value stored under key by Put and decodes it with DefaultCodec.
+func Get[T any](key string) (v T, err error) {
+	s, err := GetString(key)
+	if err != nil {
+		return v, err
+	}
+	err = decode(s, &v)
+	return v, err
+}
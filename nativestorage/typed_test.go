@@ -0,0 +1,61 @@
+package nativestorage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"unicode/utf8"
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func useCodec(t *testing.T, c Codec) {
+	saved := DefaultCodec
+	DefaultCodec = c
+	t.Cleanup(func() { DefaultCodec = saved })
+}
+
+func TestEncodeBinaryCodec(t *testing.T) {
+	useCodec(t, gobCodec{})
+	in := []byte{0xff, 0xfe, 0, 0x80}
+	s, err := encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(s) {
+		t.Fatalf("stored %q is not valid UTF-8", s)
+	}
+	var out []byte
+	if err := decode(s, &out); err != nil || !bytes.Equal(out, in) {
+		t.Fatalf("decode = % x, %v, want % x", out, err, in)
+	}
+}
+
+func TestEncodeTextCodec(t *testing.T) {
+	s, err := encode(map[string]int{"a": 1})
+	if err != nil || s != `{"a":1}` {
+		t.Fatalf("encode = %q, %v", s, err)
+	}
+}
+
+func TestDecodeCodecError(t *testing.T) {
+	var v int
+	if err := decode("not json", &v); !errors.Is(err, ErrCodec) {
+		t.Fatalf("err = %v, want ErrCodec", err)
+	}
+	useCodec(t, gobCodec{})
+	if err := decode("not base64!", &v); !errors.Is(err, ErrCodec) {
+		t.Fatalf("binary err = %v, want ErrCodec", err)
+	}
+}